@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/kube"
+	"io"
+	"strings"
+)
+
+// printDiagnostics prints the diagnostics of all resources which failed or were not ready when the wait ended,
+// grouped by release and resource
+func printDiagnostics(out io.Writer, releases []*releaseChanges) {
+	for _, r := range releases {
+		header := false
+		for _, res := range r.results {
+			if res.Diagnostics == nil {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(out, "Diagnostics of %s:\n", r)
+				header = true
+			}
+			metadata := res.Resource.Metadata
+			fmt.Fprintf(out, "  %s %s/%s is %s", metadata.Kind, metadata.ObjectMeta.Namespace, metadata.ObjectMeta.Name, res.Status)
+			if res.Message != "" {
+				fmt.Fprintf(out, ": %s", res.Message)
+			}
+			fmt.Fprintln(out)
+			fmt.Fprint(out, formatDiagnostics(res.Diagnostics, "    "))
+		}
+	}
+}
+
+// formatDiagnostics formats the diagnostics of a resource with each line indented by the given prefix
+func formatDiagnostics(d *kube.Diagnostics, indent string) string {
+	var b strings.Builder
+	writeEvents(&b, d.Events, indent)
+	for _, pod := range d.Pods {
+		fmt.Fprintf(&b, "%sPod %s (%s)\n", indent, pod.Name, pod.Phase)
+		writeEvents(&b, pod.Events, indent+"  ")
+		for _, container := range pod.Containers {
+			fmt.Fprintf(&b, "%s  Container %s: %s, restarts: %d", indent, container.Name, container.State, container.RestartCount)
+			if container.LastTermination != "" {
+				fmt.Fprintf(&b, ", last termination: %s", container.LastTermination)
+			}
+			b.WriteString("\n")
+			if container.Logs != "" {
+				for _, line := range strings.Split(container.Logs, "\n") {
+					fmt.Fprintf(&b, "%s    | %s\n", indent, line)
+				}
+			}
+		}
+	}
+	for _, err := range d.Errors {
+		fmt.Fprintf(&b, "%sFailed to collect diagnostics: %s\n", indent, err)
+	}
+	return b.String()
+}
+
+func writeEvents(b *strings.Builder, events []kube.Event, indent string) {
+	for _, e := range events {
+		fmt.Fprintf(b, "%sWarning %s (x%d): %s\n", indent, e.Reason, e.Count, e.Message)
+	}
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"github.com/dieler/helm-wait/pkg/common"
+	"github.com/dieler/helm-wait/pkg/helm"
 	"github.com/spf13/pflag"
 )
 
@@ -15,6 +17,15 @@ func New() *EnvSettings {
 	return &envSettings
 }
 
+// Namespace returns the namespace given by flag, or else the one of the Helm env, i.e. HELM_NAMESPACE
+// or the namespace of the kube context
+func (s *EnvSettings) Namespace() string {
+	if s.namespace != "" {
+		return s.namespace
+	}
+	return helm.GetNamespace(common.KubeConfig{Context: s.KubeContext, File: s.KubeConfigFile})
+}
+
 // AddBaseFlags binds base flags to the given flagset.
 func (s *EnvSettings) AddBaseFlags(fs *pflag.FlagSet) {
 }
@@ -22,7 +33,7 @@ func (s *EnvSettings) AddBaseFlags(fs *pflag.FlagSet) {
 // AddFlags binds flags to the given flagset.
 func (s *EnvSettings) AddFlags(fs *pflag.FlagSet) {
 	s.AddBaseFlags(fs)
-	fs.StringVarP(&s.namespace, "namespace", "n", s.namespace, "namespace scope for this request")
+	fs.StringVarP(&s.namespace, "namespace", "n", s.namespace, "namespace scope for this request, defaults to HELM_NAMESPACE or the namespace of the kube context")
 	fs.StringVar(&s.KubeConfigFile, "kubeconfig", "", "path to the kubeconfig file")
 	fs.StringVar(&s.KubeContext, "kube-context", s.KubeContext, "name of the kubeconfig context to use")
 }
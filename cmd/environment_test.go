@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://localhost:6443
+users:
+- name: test
+contexts:
+- name: team-a
+  context: {cluster: test, user: test, namespace: team-a}
+- name: no-namespace
+  context: {cluster: test, user: test}
+current-context: team-a
+`
+
+func TestNamespace(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(file, []byte(testKubeConfig), 0600))
+	var tests = []struct {
+		name      string
+		settings  EnvSettings
+		namespace string
+	}{
+		{"Flag", EnvSettings{namespace: "team-b", KubeConfigFile: file}, "team-b"},
+		{"KubeContext", EnvSettings{KubeConfigFile: file, KubeContext: "team-a"}, "team-a"},
+		{"KubeContextWithoutNamespace", EnvSettings{KubeConfigFile: file, KubeContext: "no-namespace"}, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.namespace, tt.settings.Namespace())
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/kube"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Exit codes of the plugin, which allow pipelines to decide whether to retry, roll back or page
+const (
+	// ExitError is the exit code of any other error
+	ExitError = 1
+	// ExitConfig is the exit code of bad arguments, an unknown release or revision, or an unreachable cluster
+	ExitConfig = 2
+	// ExitTimeout is the exit code if resources were still progressing when the timeout was reached
+	ExitTimeout = 3
+	// ExitFailed is the exit code if a workload failed, e.g. a crash looping pod, a failed job or an exceeded progress deadline
+	ExitFailed = 4
+	// ExitRelease is the exit code if a release is in a failed or pending state
+	ExitRelease = 5
+	// ExitCanceled is the exit code if waiting was canceled by SIGINT or SIGTERM, following the convention of shells
+	ExitCanceled = 130
+)
+
+// configError is an error caused by bad arguments or a cluster which cannot be accessed
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string { return e.err.Error() }
+func (e *configError) Unwrap() error { return e.err }
+
+// configErrorf returns a configError with the formatted message, which may wrap another error
+func configErrorf(format string, args ...interface{}) error {
+	return &configError{fmt.Errorf(format, args...)}
+}
+
+// asConfigError returns the given error as a configError, or nil if there is no error
+func asConfigError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &configError{err}
+}
+
+// releaseError is an error caused by a release in a failed or pending state
+type releaseError struct {
+	err error
+}
+
+func (e *releaseError) Error() string { return e.err.Error() }
+func (e *releaseError) Unwrap() error { return e.err }
+
+// releaseErrorf returns a releaseError with the formatted message, which may wrap another error
+func releaseErrorf(format string, args ...interface{}) error {
+	return &releaseError{fmt.Errorf(format, args...)}
+}
+
+// releasesError is returned if waiting for some of several releases failed, wrapping the errors of the failed ones
+type releasesError struct {
+	total int
+	errs  []error
+}
+
+func (e *releasesError) Error() string {
+	return fmt.Sprintf("%d of %d releases failed", len(e.errs), e.total)
+}
+
+func (e *releasesError) Unwrap() []error { return e.errs }
+
+// ExitCode returns the exit code for an error returned by a command. If several releases failed for different reasons,
+// the most severe one determines the exit code: a cancellation, a failed workload, a failed or pending release,
+// a timeout and finally a configuration error.
+func ExitCode(err error) int {
+	var failed *kube.FailedError
+	var release *releaseError
+	var config *configError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.Canceled):
+		return ExitCanceled
+	case errors.As(err, &failed):
+		return ExitFailed
+	case errors.As(err, &release):
+		return ExitRelease
+	case errors.Is(err, wait.ErrWaitTimeout):
+		return ExitTimeout
+	case errors.As(err, &config):
+		return ExitConfig
+	}
+	return ExitError
+}
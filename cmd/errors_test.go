@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/kube"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	failed := &kube.FailedError{}
+	pending := releaseErrorf("release my-release is pending: version=3, status=pending-upgrade")
+	timedOut := fmt.Errorf("waiting for resources: %w", wait.ErrWaitTimeout)
+	config := configErrorf("release my-release has no revision 7")
+	several := func(errs ...error) error {
+		return &releasesError{total: len(errs) + 1, errs: errs}
+	}
+	var tests = []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"NoError", nil, 0},
+		{"Other", errors.New("unexpected"), ExitError},
+		{"Config", config, ExitConfig},
+		{"Timeout", timedOut, ExitTimeout},
+		{"Failed", failed, ExitFailed},
+		{"Release", pending, ExitRelease},
+		{"Canceled", context.Canceled, ExitCanceled},
+		{"CanceledAsConfig", asConfigError(context.Canceled), ExitCanceled},
+		{"CanceledAsRelease", releaseErrorf("release my-release is still pending: %w", context.Canceled), ExitCanceled},
+		{"TimeoutOfPendingRelease", releaseErrorf("release my-release is still pending: %w", wait.ErrWaitTimeout), ExitRelease},
+		{"SeveralConfig", several(config, config), ExitConfig},
+		{"SeveralTimeoutOverConfig", several(config, timedOut), ExitTimeout},
+		{"SeveralReleaseOverTimeout", several(timedOut, pending, config), ExitRelease},
+		{"SeveralFailedOverRelease", several(pending, failed, timedOut), ExitFailed},
+		{"SeveralCanceledOverFailed", several(failed, context.Canceled, pending), ExitCanceled},
+		{"SeveralOther", several(errors.New("unexpected")), ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, ExitCode(tt.err))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/common"
+	"github.com/dieler/helm-wait/pkg/diff"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"helm.sh/helm/v3/pkg/release"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const installCmdLongUsage = `
+This command waits until all resources of the first revision of the given release have been applied.
+It refuses to wait for a release with more than one revision, unless forced to wait for all resources of its current revision.
+Hooks are only waited on for the given hook events.
+Example:
+$ helm wait install my-release
+$ helm wait install my-release --timeout 600
+$ helm wait install my-release --include-hooks post-install
+$ helm wait install my-release --force
+$ helm wait install my-release --output yaml
+`
+
+var (
+	includeHooks []string
+	force        bool
+)
+
+func newInstallCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install RELEASE_NAME",
+		Short: "Wait until all resources of a newly installed release have been applied",
+		Long:  installCmdLongUsage,
+		RunE:  runInstall,
+	}
+
+	flags := cmd.Flags()
+	addWaitFlags(flags)
+	flags.StringSliceVar(&includeHooks, "include-hooks", []string{}, "hook events (like post-install) whose hooks are waited on as well")
+	flags.BoolVar(&force, "force", false, "wait for all resources of the current revision even if the release has more than one revision")
+	settings.AddFlags(flags)
+	return cmd
+}
+
+func runInstall(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat(); err != nil {
+		return err
+	}
+	switch {
+	case len(args) < 1:
+		return configErrorf("too few arguments to command \"install\", the name of a release is required")
+	case len(args) > 1:
+		return configErrorf("too many arguments to command \"install\", only name of a release is allowed")
+	}
+	kubeConfig := common.KubeConfig{
+		Context: settings.KubeContext,
+		File:    settings.KubeConfigFile,
+	}
+	return install(cmd.Context(), args[0], settings.Namespace(), kubeConfig)
+}
+
+func install(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig) error {
+	start := time.Now()
+	deadline := newDeadline()
+	changes, err := installChanges(ctx, releaseName, namespace, kubeConfig, deadline)
+	if err != nil {
+		return failRelease(start, releaseName, namespace, err)
+	}
+	return waitForReleases(ctx, kubeConfig, deadline, changes)
+}
+
+// installChanges returns all resources of the current revision of the given release as added.
+// It returns an error if the release has more than one revision, unless forced, or if the current revision is pending or failed.
+func installChanges(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig, deadline time.Time) (*releaseChanges, error) {
+	cfg, err := getActionConfig(ctx, namespace, kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	history, err := getHistory(cfg, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	currentRelease := history[len(history)-1]
+	if len(history) > 1 && !force {
+		return nil, configErrorf("release %s has %d revisions, use --force to wait for all resources of revision %d", releaseName, len(history), currentRelease.Version)
+	}
+	if currentRelease, err = awaitRelease(ctx, cfg, currentRelease, deadline); err != nil {
+		return nil, err
+	}
+	if err := checkRelease(currentRelease); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(logOut(), "Current release: %d\n", currentRelease.Version)
+	events := make([]release.HookEvent, 0, len(includeHooks))
+	for _, hook := range includeHooks {
+		events = append(events, release.HookEvent(hook))
+	}
+	resources, err := manifest.ParseReleaseWithHooks(currentRelease, events...)
+	if err = checkManifest(logOut(), currentRelease, err); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]*manifest.MappingResult, 0, len(names))
+	changes := make(map[string]diff.Change, len(names))
+	for _, name := range names {
+		result = append(result, resources[name])
+		changes[name] = diff.ADDED
+	}
+	return &releaseChanges{release: currentRelease, changes: changes, resources: resources, changed: result}, nil
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/kube"
+	"os"
+	"time"
+)
+
+// junitTestSuites is the root element of a JUnit XML report, with a test suite per release
+// and a test case per resource waited on
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// newJUnitReport builds a JUnit report of the given releases. Resources which failed or were still pending
+// when the wait ended are failures with their last observed status, releases whose changes could not be determined
+// or whose resources could not be watched are reported as errors.
+func newJUnitReport(releases []*releaseChanges, errs []error, duration time.Duration) *junitTestSuites {
+	result := &junitTestSuites{Time: junitTime(duration)}
+	for i, r := range releases {
+		suite := junitTestSuite{Name: r.String(), Time: junitTime(r.duration)}
+		for _, res := range r.results {
+			metadata := res.Resource.Metadata
+			testCase := junitTestCase{
+				Name:      fmt.Sprintf("%s %s/%s is %s", metadata.Kind, metadata.ObjectMeta.Namespace, metadata.ObjectMeta.Name, expectedStatus(r, res)),
+				ClassName: r.String(),
+				Time:      junitTime(res.Duration),
+			}
+			switch res.Status {
+			case kube.StatusFailed:
+				testCase.Failure = &junitFailure{Message: res.Message, Type: string(res.Status), Text: res.Message}
+			case kube.StatusPending:
+				message := fmt.Sprintf("timed out after %s", res.Duration.Round(time.Millisecond))
+				if res.Message != "" {
+					message = fmt.Sprintf("%s: %s", message, res.Message)
+				}
+				testCase.Failure = &junitFailure{Message: message, Type: "timeout", Text: message}
+			}
+			if testCase.Failure != nil {
+				if res.Diagnostics != nil {
+					testCase.Failure.Text += "\n" + formatDiagnostics(res.Diagnostics, "")
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		// Errors which are not caused by a resource, like a release without history or an unreachable cluster
+		if errs[i] != nil && suite.Failures == 0 {
+			suite.Errors++
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      fmt.Sprintf("%s is ready", r),
+				ClassName: r.String(),
+				Time:      junitTime(r.duration),
+				Error:     &junitFailure{Message: errs[i].Error(), Type: "error", Text: errs[i].Error()},
+			})
+		}
+		suite.Tests = len(suite.Cases)
+		result.Tests += suite.Tests
+		result.Failures += suite.Failures
+		result.Errors += suite.Errors
+		result.Suites = append(result.Suites, suite)
+	}
+	return result
+}
+
+// newJUnitErrorReport builds a JUnit report with a single error for releases which could not be listed
+func newJUnitErrorReport(err error, duration time.Duration) *junitTestSuites {
+	suite := junitTestSuite{
+		Name:   "releases",
+		Tests:  1,
+		Errors: 1,
+		Time:   junitTime(duration),
+		Cases: []junitTestCase{{
+			Name:      "releases are listed",
+			ClassName: "releases",
+			Time:      junitTime(duration),
+			Error:     &junitFailure{Message: err.Error(), Type: "error", Text: err.Error()},
+		}},
+	}
+	return &junitTestSuites{Tests: 1, Errors: 1, Time: junitTime(duration), Suites: []junitTestSuite{suite}}
+}
+
+// expectedStatus returns the status a resource was waited for, which is deleted for removed resources
+func expectedStatus(r *releaseChanges, res kube.Result) kube.Status {
+	for _, removed := range r.removed {
+		if removed == res.Resource {
+			return kube.StatusDeleted
+		}
+	}
+	return kube.StatusReady
+}
+
+// junitTime formats a duration in seconds as expected by JUnit
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnitReport writes the JUnit report to the given file, if any
+func writeJUnitReport(file string, report *junitTestSuites) error {
+	if file == "" {
+		return nil
+	}
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
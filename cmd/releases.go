@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/common"
+	"github.com/dieler/helm-wait/pkg/diff"
+	"github.com/dieler/helm-wait/pkg/kube"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// releaseChanges holds the resources of a release revision to wait for and the results of waiting for them,
+// or the error why the changes of a release could not be determined. The resources hold every changed resource
+// by the same key as the changes, taken from the previous revision for removed ones.
+type releaseChanges struct {
+	release   *release.Release
+	previous  *release.Release
+	changes   map[string]diff.Change
+	resources map[string]*manifest.MappingResult
+	changed   []*manifest.MappingResult
+	removed   []*manifest.MappingResult
+	err       error
+	results   []kube.Result
+	duration  time.Duration
+}
+
+func (r *releaseChanges) String() string {
+	return fmt.Sprintf("%s/%s", r.release.Namespace, r.release.Name)
+}
+
+// wait waits until the changed resources are ready and the removed resources are deleted until the given deadline
+func (r *releaseChanges) wait(ctx context.Context, kc *kube.Client, deadline time.Time) error {
+	start := time.Now()
+	defer func() {
+		r.duration = time.Since(start)
+	}()
+	results, err := kc.WaitForResources(ctx, time.Until(deadline), r.changed)
+	r.results = append(r.results, results...)
+	if err != nil || len(r.removed) == 0 {
+		return err
+	}
+	results, err = kc.WaitForDeletion(ctx, time.Until(deadline), r.removed)
+	r.results = append(r.results, results...)
+	return err
+}
+
+// waitForReleases waits for the changes of all given releases in parallel until the shared deadline using the wait flags.
+// The output of several releases is prefixed by their names and followed by a summary of all releases.
+// With a structured output format, a report of all releases is printed as well, and a JUnit report is written if requested.
+func waitForReleases(ctx context.Context, kubeConfig common.KubeConfig, deadline time.Time, releases ...*releaseChanges) error {
+	start := time.Now()
+	if len(releases) == 1 && releases[0].err == nil {
+		kc, err := newKubeClient(kubeConfig, logOut())
+		if err == nil {
+			err = releases[0].wait(ctx, kc, deadline)
+		}
+		printCanceled(logOut(), releases, []error{err})
+		if reportErr := writeReports(releases, []error{err}, time.Since(start)); reportErr != nil {
+			return reportErr
+		}
+		return err
+	}
+	var mu sync.Mutex
+	var clientErr error
+	clients := make([]*kube.Client, len(releases))
+	for i, r := range releases {
+		if r.err != nil {
+			continue
+		}
+		kc, err := newKubeClient(kubeConfig, &prefixWriter{prefix: fmt.Sprintf("[%s] ", r), out: logOut(), mu: &mu})
+		if err != nil {
+			clientErr = err
+			break
+		}
+		clients[i] = kc
+	}
+	errs := make([]error, len(releases))
+	var wg sync.WaitGroup
+	for i, r := range releases {
+		if r.err != nil {
+			errs[i] = r.err
+			continue
+		}
+		if clientErr != nil {
+			errs[i] = clientErr
+			continue
+		}
+		wg.Add(1)
+		go func(i int, r *releaseChanges) {
+			defer wg.Done()
+			errs[i] = r.wait(ctx, clients[i], deadline)
+		}(i, r)
+	}
+	wg.Wait()
+	printCanceled(logOut(), releases, errs)
+	if err := writeReports(releases, errs, time.Since(start)); err != nil {
+		return err
+	}
+	return summarize(logOut(), releases, errs)
+}
+
+// failRelease writes the reports for a release whose changes could not be determined, so that the failure
+// is reported in the structured output as well, and returns the given error
+func failRelease(start time.Time, releaseName, namespace string, err error) error {
+	releases := []*releaseChanges{{release: &release.Release{Name: releaseName, Namespace: namespace}, err: err}}
+	if reportErr := writeReports(releases, []error{err}, time.Since(start)); reportErr != nil {
+		return reportErr
+	}
+	return err
+}
+
+// failListing prints a report without releases and writes a JUnit report with an error for releases which could not be listed,
+// and returns the given error
+func failListing(start time.Time, err error) error {
+	duration := time.Since(start)
+	r := newReport(nil, nil, duration)
+	r.Status = statusFailed
+	r.Error = err.Error()
+	if reportErr := printReport(os.Stdout, r); reportErr != nil {
+		return reportErr
+	}
+	if reportErr := writeJUnitReport(junitReport, newJUnitErrorReport(err, duration)); reportErr != nil {
+		return reportErr
+	}
+	return err
+}
+
+// printCanceled prints the resources which were still pending when waiting for a release was canceled
+func printCanceled(out io.Writer, releases []*releaseChanges, errs []error) {
+	for i, r := range releases {
+		if !errors.Is(errs[i], context.Canceled) {
+			continue
+		}
+		fmt.Fprintf(out, "Canceled while waiting for %s:\n", r)
+		for _, res := range r.results {
+			if res.Status != kube.StatusPending {
+				continue
+			}
+			metadata := res.Resource.Metadata
+			fmt.Fprintf(out, "  %s %s/%s", metadata.Kind, metadata.ObjectMeta.Namespace, metadata.ObjectMeta.Name)
+			if res.Message != "" {
+				fmt.Fprintf(out, ": %s", res.Message)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+// summarize prints the outcome of every release and returns an error wrapping the errors of the failed ones
+func summarize(out io.Writer, releases []*releaseChanges, errs []error) error {
+	var failed []error
+	fmt.Fprintf(out, "Summary:\n")
+	for i, r := range releases {
+		switch {
+		case r.err != nil:
+			failed = append(failed, errs[i])
+			fmt.Fprintf(out, "  %s: failed: %v\n", r, errs[i])
+		case errs[i] != nil:
+			failed = append(failed, errs[i])
+			fmt.Fprintf(out, "  %s (revision %d): failed: %v\n", r, r.release.Version, errs[i])
+		default:
+			fmt.Fprintf(out, "  %s (revision %d): ready\n", r, r.release.Version)
+		}
+	}
+	if len(failed) > 0 {
+		return &releasesError{total: len(releases), errs: failed}
+	}
+	return nil
+}
+
+// listReleases returns the latest revisions of all releases in the given namespace, or in all namespaces,
+// which match the label selector
+func listReleases(ctx context.Context, namespace string, allNamespaces bool, selector string, kubeConfig common.KubeConfig) ([]*release.Release, error) {
+	if allNamespaces {
+		namespace = ""
+	}
+	cfg, err := getActionConfig(ctx, namespace, kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	list := action.NewList(cfg)
+	list.AllNamespaces = allNamespaces
+	list.Selector = selector
+	list.StateMask = action.ListDeployed | action.ListFailed | action.ListPendingInstall | action.ListPendingUpgrade | action.ListPendingRollback
+	releases, err := list.Run()
+	return releases, asConfigError(err)
+}
+
+// prefixWriter writes complete lines prefixed to the underlying writer, which is shared by several prefixWriters
+// guarded by the same mutex, so that lines written concurrently are not interleaved
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// Keep the incomplete line until it is completed by the next write
+			w.buf.Write(line)
+			return len(p), nil
+		}
+		w.mu.Lock()
+		_, err = fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+		w.mu.Unlock()
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/dieler/helm-wait/pkg/kube"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// report is the structured document of the diff and wait results of all releases. The error is only set
+// if the releases to wait for could not be listed.
+type report struct {
+	Status   string          `json:"status"`
+	Duration string          `json:"duration"`
+	Error    string          `json:"error,omitempty"`
+	Releases []releaseReport `json:"releases"`
+}
+
+type releaseReport struct {
+	Name             string           `json:"name"`
+	Namespace        string           `json:"namespace"`
+	Revision         int              `json:"revision"`
+	PreviousRevision int              `json:"previousRevision,omitempty"`
+	Status           string           `json:"status"`
+	Duration         string           `json:"duration"`
+	Error            string           `json:"error,omitempty"`
+	Resources        []resourceReport `json:"resources"`
+}
+
+// resourceReport is the change of a resource and the outcome of waiting for it. The status is omitted
+// for resources which have not been waited on, like removed resources without waiting for their deletion.
+type resourceReport struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Change    string `json:"change"`
+	Status    string `json:"status,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+	Message   string `json:"message,omitempty"`
+	// Diagnostics are collected for resources which failed or were pending when the wait ended
+	Diagnostics *kube.Diagnostics `json:"diagnostics,omitempty"`
+}
+
+const (
+	statusSucceeded = "succeeded"
+	statusFailed    = "failed"
+)
+
+// newReport builds the report of the given releases and the errors of waiting for them
+func newReport(releases []*releaseChanges, errs []error, duration time.Duration) *report {
+	result := &report{Status: statusSucceeded, Duration: duration.String(), Releases: []releaseReport{}}
+	for i, r := range releases {
+		rr := releaseReport{
+			Name:      r.release.Name,
+			Namespace: r.release.Namespace,
+			Revision:  r.release.Version,
+			Status:    statusSucceeded,
+			Duration:  r.duration.String(),
+			Resources: []resourceReport{},
+		}
+		if r.previous != nil {
+			rr.PreviousRevision = r.previous.Version
+		}
+		if errs[i] != nil {
+			rr.Status = statusFailed
+			rr.Error = errs[i].Error()
+			result.Status = statusFailed
+		}
+		results := make(map[string]kube.Result, len(r.results))
+		for _, res := range r.results {
+			results[res.Resource.Name] = res
+		}
+		names := make([]string, 0, len(r.changes))
+		for name := range r.changes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			metadata := r.resources[name].Metadata
+			resource := resourceReport{
+				Name:      metadata.ObjectMeta.Name,
+				Kind:      metadata.Kind,
+				Namespace: metadata.ObjectMeta.Namespace,
+				Change:    r.changes[name].String(),
+			}
+			if res, ok := results[name]; ok {
+				resource.Status = string(res.Status)
+				resource.Duration = res.Duration.String()
+				resource.Message = res.Message
+				resource.Diagnostics = res.Diagnostics
+			}
+			rr.Resources = append(rr.Resources, resource)
+		}
+		result.Releases = append(result.Releases, rr)
+	}
+	return result
+}
+
+// writeReports prints the diagnostics of failed resources and the structured report, and writes the JUnit report, if requested
+func writeReports(releases []*releaseChanges, errs []error, duration time.Duration) error {
+	printDiagnostics(logOut(), releases)
+	if err := printReport(os.Stdout, newReport(releases, errs, duration)); err != nil {
+		return err
+	}
+	return writeJUnitReport(junitReport, newJUnitReport(releases, errs, duration))
+}
+
+// validateOutputFormat returns an error if the output format is unknown
+func validateOutputFormat() error {
+	switch outputFormat {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	}
+	return configErrorf("unknown output format %q, use one of text, json or yaml", outputFormat)
+}
+
+// printReport prints the report in the structured output format, if any
+func printReport(out io.Writer, r *report) error {
+	var data []byte
+	var err error
+	switch outputFormat {
+	case outputText:
+		return nil
+	case outputJSON:
+		data, err = json.MarshalIndent(r, "", "  ")
+		data = append(data, '\n')
+	case outputYAML:
+		data, err = yaml.Marshal(r)
+	default:
+		return validateOutputFormat()
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+	"testing"
+	"time"
+)
+
+func TestReportOfReleaseWithoutChanges(t *testing.T) {
+	outputFormat = outputJSON
+	t.Cleanup(func() { outputFormat = outputText })
+	err := releaseErrorf("release my-release is pending: version=3, status=pending-upgrade")
+	releases := []*releaseChanges{{release: &release.Release{Name: "my-release", Namespace: "default"}, err: err}}
+
+	var out bytes.Buffer
+	require.NoError(t, printReport(&out, newReport(releases, []error{err}, time.Second)))
+
+	require.JSONEq(t, `{
+  "status": "failed",
+  "duration": "1s",
+  "releases": [
+    {
+      "name": "my-release",
+      "namespace": "default",
+      "revision": 0,
+      "status": "failed",
+      "duration": "0s",
+      "error": "release my-release is pending: version=3, status=pending-upgrade",
+      "resources": []
+    }
+  ]
+}`, out.String())
+}
+
+func TestReportWithoutReleases(t *testing.T) {
+	outputFormat = outputYAML
+	t.Cleanup(func() { outputFormat = outputText })
+	r := newReport(nil, nil, time.Second)
+	r.Status = statusFailed
+	r.Error = "releases cannot be listed"
+
+	var out bytes.Buffer
+	require.NoError(t, printReport(&out, r))
+
+	require.Equal(t, "duration: 1s\nerror: releases cannot be listed\nreleases: []\nstatus: failed\n", out.String())
+}
+
+func TestReportOfResourcesNotWaitedOn(t *testing.T) {
+	previous := newRelease(1, release.StatusSuperseded)
+	previous.Manifest += `---
+# Source: chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+`
+	changes, err := getChanges(previous, newRelease(2, release.StatusDeployed), &bytes.Buffer{})
+	require.NoError(t, err)
+
+	r := newReport([]*releaseChanges{changes}, []error{nil}, time.Second)
+
+	require.Equal(t, []resourceReport{
+		{Name: "config", Kind: "ConfigMap", Namespace: "default", Change: "CHANGED"},
+		{Name: "nginx", Kind: "Deployment", Namespace: "default", Change: "REMOVED"},
+	}, r.Releases[0].Resources)
+}
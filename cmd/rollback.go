@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"github.com/dieler/helm-wait/pkg/common"
+	"helm.sh/helm/v3/pkg/action"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const rollbackCmdLongUsage = `
+This command compares the current revision of the given release, which must be the result of a rollback, with the revision it replaced
+and waits until all changes of the current revision have been applied.
+Example:
+$ helm wait rollback my-release
+$ helm wait rollback my-release --timeout 600
+$ helm wait rollback my-release --output json
+`
+
+// rollbackDescriptionPrefix is the prefix of the description Helm records for a revision created by a rollback
+const rollbackDescriptionPrefix = "Rollback to "
+
+func newRollbackCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback RELEASE_NAME",
+		Short: "Wait until all changes of a rollback have been applied",
+		Long:  rollbackCmdLongUsage,
+		RunE:  runRollback,
+	}
+
+	flags := cmd.Flags()
+	addWaitFlags(flags)
+	addRemovedFlags(flags)
+	addDiffFlags(flags)
+	settings.AddFlags(flags)
+	return cmd
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat(); err != nil {
+		return err
+	}
+	switch {
+	case len(args) < 1:
+		return configErrorf("too few arguments to command \"rollback\", the name of a release is required")
+	case len(args) > 1:
+		return configErrorf("too many arguments to command \"rollback\", only name of a release is allowed")
+	}
+	kubeConfig := common.KubeConfig{
+		Context: settings.KubeContext,
+		File:    settings.KubeConfigFile,
+	}
+	return rollback(cmd.Context(), args[0], settings.Namespace(), kubeConfig)
+}
+
+func rollback(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig) error {
+	start := time.Now()
+	deadline := newDeadline()
+	changes, err := rollbackChanges(ctx, releaseName, namespace, kubeConfig, deadline)
+	if err != nil {
+		return failRelease(start, releaseName, namespace, err)
+	}
+	return waitForReleases(ctx, kubeConfig, deadline, changes)
+}
+
+// rollbackChanges returns the changes of the current revision of the given release compared to the revision it replaced.
+// It returns an error if the current revision is pending, failed or not the result of a rollback.
+func rollbackChanges(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig, deadline time.Time) (*releaseChanges, error) {
+	cfg, err := getActionConfig(ctx, namespace, kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return rolledBackChanges(ctx, cfg, releaseName, deadline, logOut())
+}
+
+// rolledBackChanges returns the changes of the current revision of the given release in the release storage
+// of the given configuration compared to the revision it replaced
+func rolledBackChanges(ctx context.Context, cfg *action.Configuration, releaseName string, deadline time.Time, out io.Writer) (*releaseChanges, error) {
+	history, err := getHistory(cfg, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	currentRelease := history[len(history)-1]
+	if currentRelease, err = awaitRelease(ctx, cfg, currentRelease, deadline); err != nil {
+		return nil, err
+	}
+	if err := checkRelease(currentRelease); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(currentRelease.Info.Description, rollbackDescriptionPrefix) || len(history) < 2 {
+		return nil, configErrorf("revision %d of release %s is not a rollback: %s", currentRelease.Version, releaseName, currentRelease.Info.Description)
+	}
+	// The manifest of the current revision equals the one of the revision rolled back to,
+	// but the changes to be applied are those compared to the revision it replaced
+	previousRelease := history[len(history)-2]
+	return getChanges(previousRelease, currentRelease, out)
+}
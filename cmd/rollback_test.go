@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"testing"
+)
+
+func TestRolledBackChanges(t *testing.T) {
+	rollback := func(version, to int) *release.Release {
+		r := newRelease(version, release.StatusDeployed)
+		r.Manifest = newRelease(to, release.StatusDeployed).Manifest
+		r.Info.Description = "Rollback to 1"
+		return r
+	}
+	var tests = []struct {
+		name     string
+		history  []*release.Release
+		previous int
+		err      string
+	}{
+		{"Rollback", []*release.Release{
+			newRelease(1, release.StatusSuperseded),
+			newRelease(2, release.StatusSuperseded),
+			rollback(3, 1),
+		}, 2, ""},
+		{"ComparedToReplacedRevision", []*release.Release{
+			newRelease(1, release.StatusSuperseded),
+			newRelease(2, release.StatusSuperseded),
+			newRelease(3, release.StatusSuperseded),
+			rollback(4, 1),
+		}, 3, ""},
+		{"NoRollback", []*release.Release{
+			newRelease(1, release.StatusSuperseded),
+			newRelease(2, release.StatusDeployed),
+		}, 0, "revision 2 of release my-release is not a rollback: "},
+		{"SingleRevision", []*release.Release{
+			rollback(1, 1),
+		}, 0, "revision 1 of release my-release is not a rollback: Rollback to 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+			for _, r := range tt.history {
+				require.NoError(t, cfg.Releases.Create(r))
+			}
+
+			changes, err := rolledBackChanges(context.Background(), cfg, "my-release", newDeadline(), &bytes.Buffer{})
+
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				require.Equal(t, ExitConfig, ExitCode(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, len(tt.history), changes.release.Version)
+			require.Equal(t, tt.previous, changes.previous.Version)
+			// The rolled back manifest differs from the one of the revision it replaced
+			require.Len(t, changes.changed, 1)
+		})
+	}
+}
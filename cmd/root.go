@@ -1,13 +1,24 @@
 package cmd
 
 import (
-	"errors"
 	"io"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+const rootCmdLongUsage = `helm wait plugin
+
+Exit codes:
+  0    all resources are ready or deleted
+  1    any other error
+  2    bad arguments, unknown release or revision, or the cluster cannot be accessed
+  3    timed out while resources were still progressing
+  4    a workload failed, e.g. a crash looping or unschedulable pod, a failed job or an exceeded progress deadline
+  5    the release is in a failed or pending state
+  130  canceled by SIGINT or SIGTERM
+`
+
 var (
 	settings *EnvSettings
 )
@@ -16,16 +27,20 @@ func NewRootCmd(out io.Writer, args []string) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:          "wait",
 		Short:        "helm wait plugin",
-		Long:         "helm wait plugin",
+		Long:         rootCmdLongUsage,
 		SilenceUsage: true,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) > 0 {
-				return errors.New("no arguments accepted")
+				return configErrorf("no arguments accepted")
 			}
 			return nil
 		},
 	}
 
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return asConfigError(err)
+	})
+
 	flags := cmd.PersistentFlags()
 	flags.Parse(args)
 	settings = new(EnvSettings)
@@ -35,7 +50,10 @@ func NewRootCmd(out io.Writer, args []string) *cobra.Command {
 	}
 
 	cmd.AddCommand(
+		newInstallCmd(out),
 		newUpgradeCmd(out),
+		newRollbackCmd(out),
+		newUninstallCmd(out),
 	)
 
 	return cmd
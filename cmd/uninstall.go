@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/common"
+	"github.com/dieler/helm-wait/pkg/diff"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const uninstallCmdLongUsage = `
+This command takes the last known revision of the given release and waits until all its resources have been deleted.
+Resources kept by the resource policy and hooks are not waited on.
+As the release history is needed, the release must be uninstalled with --keep-history or this command must run while it is uninstalled.
+Example:
+$ helm wait uninstall my-release
+$ helm wait uninstall my-release --timeout 600
+$ helm wait uninstall my-release --output json
+`
+
+func newUninstallCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "uninstall RELEASE_NAME",
+		Short: "Wait until all resources of an uninstalled release have been deleted",
+		Long:  uninstallCmdLongUsage,
+		RunE:  runUninstall,
+	}
+
+	flags := cmd.Flags()
+	flags.Int64Var(&timeout, "timeout", 300, "time in seconds to wait for the deletion of all resources")
+	addFinalizerFlags(flags)
+	addOutputFlags(flags)
+	settings.AddFlags(flags)
+	return cmd
+}
+
+func runUninstall(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat(); err != nil {
+		return err
+	}
+	switch {
+	case len(args) < 1:
+		return configErrorf("too few arguments to command \"uninstall\", the name of a release is required")
+	case len(args) > 1:
+		return configErrorf("too many arguments to command \"uninstall\", only name of a release is allowed")
+	}
+	kubeConfig := common.KubeConfig{
+		Context: settings.KubeContext,
+		File:    settings.KubeConfigFile,
+	}
+	return uninstall(cmd.Context(), args[0], settings.Namespace(), kubeConfig)
+}
+
+func uninstall(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig) error {
+	start := time.Now()
+	changes, err := uninstallChanges(ctx, releaseName, namespace, kubeConfig)
+	if err != nil {
+		return failRelease(start, releaseName, namespace, err)
+	}
+	return waitForReleases(ctx, kubeConfig, newDeadline(), changes)
+}
+
+// uninstallChanges returns the resources of the last revision of the given release which are deleted by Helm as removed.
+// It returns an error if the release has no history or is not uninstalled.
+func uninstallChanges(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig) (*releaseChanges, error) {
+	cfg, err := getActionConfig(ctx, namespace, kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	history, err := getHistory(cfg, releaseName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, configErrorf("release %s has no history, uninstall it with --keep-history to wait for the deletion of its resources", releaseName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	lastRelease := history[len(history)-1]
+	fmt.Fprintf(logOut(), "Last release: %d, status=%s\n", lastRelease.Version, lastRelease.Info.Status)
+	if status := lastRelease.Info.Status; status != release.StatusUninstalled && status != release.StatusUninstalling {
+		return nil, configErrorf("release %s is not uninstalled: version=%d, status=%s", releaseName, lastRelease.Version, status)
+	}
+	specs, err := manifest.ParseReleaseWithHooks(lastRelease)
+	if err = checkManifest(logOut(), lastRelease, err); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resources := make([]*manifest.MappingResult, 0, len(names))
+	for _, name := range names {
+		resources = append(resources, specs[name])
+	}
+	removed := deletedByHelm(resources)
+	changes := make(map[string]diff.Change, len(removed))
+	for _, r := range removed {
+		changes[r.Name] = diff.REMOVED
+	}
+	return &releaseChanges{release: lastRelease, changes: changes, resources: specs, removed: removed}, nil
+}
@@ -1,16 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/dieler/helm-wait/pkg/common"
-	"github.com/dieler/helm-wait/pkg/diff"
-	"github.com/dieler/helm-wait/pkg/helm"
-	"github.com/dieler/helm-wait/pkg/kube"
-	"github.com/dieler/helm-wait/pkg/manifest"
+	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/release"
 	"io"
-	"os"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -18,18 +15,35 @@ import (
 
 const upgradeCmdLongUsage = `
 This command compares the current revision of the given release with its previous revision and waits until all changes of the current revision have been applied.
+The revisions to compare can be given explicitly. Changes of formatting, comments or key order are ignored, unless the raw text is compared.
+Instead of a single release, several releases, all releases in a namespace, matching a label selector or across all namespaces
+can be waited on in parallel.
 Example:
 $ helm wait upgrade my-release
 $ helm wait upgrade my-release --timeout 600
+$ helm wait upgrade my-release --max-restarts 0
+$ helm wait upgrade my-release --wait-for-removed --ignore-finalizers kubernetes.io/pvc-protection
+$ helm wait upgrade my-release --from-revision 3 --to-revision 5
+$ helm wait upgrade my-release --wait-for-pending
+$ helm wait upgrade rel-a rel-b rel-c
+$ helm wait upgrade --all
+$ helm wait upgrade --selector owner=helmfile --all-namespaces
+$ helm wait upgrade my-release --output json
+$ helm wait upgrade --all --junit-report report.xml
+$ helm wait upgrade my-release --raw-diff
 `
 
 var (
-	timeout int64
+	fromRevision  int
+	toRevision    int
+	allReleases   bool
+	selector      string
+	allNamespaces bool
 )
 
 func newUpgradeCmd(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "upgrade RELEASE_NAME",
+		Use:   "upgrade [RELEASE_NAME...]",
 		Short: "Wait until all changes in the current release have been applied",
 		Long:  upgradeCmdLongUsage,
 		Args: func(cmd *cobra.Command, args []string) error {
@@ -39,64 +53,155 @@ func newUpgradeCmd(out io.Writer) *cobra.Command {
 	}
 
 	flags := cmd.Flags()
-	flags.Int64Var(&timeout, "timeout", 300, "time in seconds to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	addWaitFlags(flags)
+	addRemovedFlags(flags)
+	addDiffFlags(flags)
+	flags.IntVar(&fromRevision, "from-revision", 0, "revision to compare from, defaults to the last superseded revision before the revision to compare to")
+	flags.IntVar(&toRevision, "to-revision", 0, "revision to compare to, defaults to the current revision")
+	flags.BoolVar(&allReleases, "all", false, "wait for all releases in the namespace")
+	flags.StringVarP(&selector, "selector", "l", "", "wait for all releases matching the Helm release label selector (e.g. -l key1=value1,key2=value2)")
+	flags.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "wait for all releases across all namespaces")
 	settings.AddFlags(flags)
 	return cmd
 }
 
 func runUpgrade(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat(); err != nil {
+		return err
+	}
+	multiple := allReleases || selector != "" || allNamespaces
 	switch {
+	case fromRevision < 0 || toRevision < 0:
+		return configErrorf("--from-revision and --to-revision must be positive")
+	case multiple && len(args) > 0:
+		return configErrorf("no release name is allowed together with --all, --selector or --all-namespaces")
+	case multiple && (fromRevision > 0 || toRevision > 0):
+		return configErrorf("--from-revision and --to-revision are not allowed together with --all, --selector or --all-namespaces")
+	case multiple:
 	case len(args) < 1:
-		return errors.New("too few arguments to command \"upgrade\", the name of a release is required")
-	case len(args) > 1:
-		return errors.New("too many arguments to command \"upgrade\", only name of a release is allowed")
+		return configErrorf("too few arguments to command \"upgrade\", the name of a release is required")
+	case len(args) > 1 && (fromRevision > 0 || toRevision > 0):
+		return configErrorf("--from-revision and --to-revision are only allowed for a single release")
 	}
 	kubeConfig := common.KubeConfig{
 		Context: settings.KubeContext,
 		File:    settings.KubeConfigFile,
 	}
-	return upgrade(args[0], settings.namespace, kubeConfig)
+	namespace := settings.Namespace()
+	deadline := newDeadline()
+	if multiple {
+		return upgradeAll(cmd.Context(), namespace, kubeConfig, deadline)
+	}
+	if len(args) > 1 {
+		releases := make([]*release.Release, 0, len(args))
+		for _, name := range args {
+			releases = append(releases, &release.Release{Name: name, Namespace: namespace})
+		}
+		return upgradeReleases(cmd.Context(), releases, kubeConfig, deadline)
+	}
+	return upgrade(cmd.Context(), args[0], namespace, kubeConfig, deadline)
 }
 
-func upgrade(releaseName, namespace string, kubeConfig common.KubeConfig) error {
-	cfg, err := helm.GetActionConfig(namespace, kubeConfig)
+func upgrade(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig, deadline time.Time) error {
+	start := time.Now()
+	changes, err := upgradeChanges(ctx, releaseName, namespace, kubeConfig, deadline, logOut())
 	if err != nil {
-		return err
+		return failRelease(start, releaseName, namespace, err)
 	}
-	history, err := cfg.Releases.History(releaseName)
+	return waitForReleases(ctx, kubeConfig, deadline, changes)
+}
+
+// upgradeAll waits for all listed releases
+func upgradeAll(ctx context.Context, namespace string, kubeConfig common.KubeConfig, deadline time.Time) error {
+	start := time.Now()
+	releases, err := listReleases(ctx, namespace, allNamespaces, selector, kubeConfig)
 	if err != nil {
-		return err
+		return failListing(start, err)
 	}
-	currentRelease := history[len(history)-1]
-	currentRelease.Info.Status.IsPending()
-	if currentRelease.Info.Status.IsPending() {
-		fmt.Printf("Current version is not an update or was not successful: version=%d, status=%s\n", currentRelease.Version, currentRelease.Info.Status)
-		return nil
+	if len(releases) == 0 {
+		fmt.Fprintln(logOut(), "No releases found")
+		return writeReports(nil, nil, time.Since(start))
 	}
-	var previousRelease *release.Release
-	for i := len(history) - 2; i >= 0; i-- {
-		r := history[i]
-		if r.Info.Status == release.StatusSuperseded {
-			previousRelease = r
-			break
+	return upgradeReleases(ctx, releases, kubeConfig, deadline)
+}
+
+// upgradeReleases computes the changes of the given releases, identified by name and namespace, one after the other
+// and waits for them in parallel. Releases whose changes cannot be determined are reported as failed.
+func upgradeReleases(ctx context.Context, releases []*release.Release, kubeConfig common.KubeConfig, deadline time.Time) error {
+	var all []*releaseChanges
+	for _, r := range releases {
+		fmt.Fprintf(logOut(), "Release: %s/%s\n", r.Namespace, r.Name)
+		changes, err := upgradeChanges(ctx, r.Name, r.Namespace, kubeConfig, deadline, logOut())
+		if errors.Is(err, context.Canceled) {
+			return err
 		}
+		if err != nil {
+			fmt.Fprintf(logOut(), "Error: %v\n", err)
+			changes = &releaseChanges{release: r, err: err}
+		}
+		all = append(all, changes)
 	}
-	fmt.Printf("Current release: %d\n", currentRelease.Version)
-	currentSpecs := manifest.ParseRelease(currentRelease, false)
-	var previousSpecs map[string]*manifest.MappingResult
-	if previousRelease == nil {
-		previousSpecs = map[string]*manifest.MappingResult{}
-	} else {
-		fmt.Printf("Previous release: %d\n", previousRelease.Version)
-		previousSpecs = manifest.ParseRelease(previousRelease, false)
-	}
-	changes, err := diff.GetModifiedOrNewResources(previousSpecs, currentSpecs, os.Stdout)
+	return waitForReleases(ctx, kubeConfig, deadline, all...)
+}
+
+// upgradeChanges returns the changes of the current revision of the given release compared to its previous revision.
+// It returns an error if the current revision is pending or failed.
+func upgradeChanges(ctx context.Context, releaseName, namespace string, kubeConfig common.KubeConfig, deadline time.Time, out io.Writer) (*releaseChanges, error) {
+	cfg, err := getActionConfig(ctx, namespace, kubeConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	kc, err := kube.New(os.Stdout)
+	return revisionChanges(ctx, cfg, releaseName, deadline, out)
+}
+
+// revisionChanges returns the changes between the revisions to compare of the given release in the release storage
+// of the given configuration
+func revisionChanges(ctx context.Context, cfg *action.Configuration, releaseName string, deadline time.Time, out io.Writer) (*releaseChanges, error) {
+	history, err := getHistory(cfg, releaseName)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	current := len(history) - 1
+	if toRevision > 0 {
+		if current, err = findRevision(history, releaseName, toRevision); err != nil {
+			return nil, err
+		}
+	}
+	currentRelease := history[current]
+	pending := currentRelease.Info.Status.IsPending()
+	if currentRelease, err = awaitRelease(ctx, cfg, currentRelease, deadline); err != nil {
+		return nil, err
+	}
+	if err := checkRelease(currentRelease); err != nil {
+		return nil, err
+	}
+	if pending {
+		// Helm marks the previous revision as superseded only when the pending one has finished
+		if history, err = getHistory(cfg, releaseName); err != nil {
+			return nil, err
+		}
+		if current, err = findRevision(history, releaseName, currentRelease.Version); err != nil {
+			return nil, err
+		}
+	}
+	var previousRelease *release.Release
+	if fromRevision > 0 {
+		previous, err := findRevision(history, releaseName, fromRevision)
+		if err != nil {
+			return nil, err
+		}
+		if previous >= current {
+			return nil, configErrorf("revision to compare from (%d) must be older than revision to compare to (%d)", fromRevision, currentRelease.Version)
+		}
+		previousRelease = history[previous]
+	} else {
+		for i := current - 1; i >= 0; i-- {
+			r := history[i]
+			if r.Info.Status == release.StatusSuperseded {
+				previousRelease = r
+				break
+			}
+		}
 	}
-	return kc.WaitForResources(time.Duration(timeout)*time.Second, changes)
+	return getChanges(previousRelease, currentRelease, out)
 }
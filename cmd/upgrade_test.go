@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"testing"
+	"time"
+)
+
+func newRelease(version int, status release.Status) *release.Release {
+	return &release.Release{
+		Name:      "my-release",
+		Namespace: "default",
+		Version:   version,
+		Info:      &release.Info{Status: status},
+		Manifest: fmt.Sprintf(`---
+# Source: chart/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  revision: "%d"
+`, version),
+	}
+}
+
+func TestRevisionChangesOfPendingUpgrade(t *testing.T) {
+	waitForPending, timeout = true, 10
+	t.Cleanup(func() { waitForPending, timeout = false, 300 })
+	cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	require.NoError(t, cfg.Releases.Create(newRelease(1, release.StatusSuperseded)))
+	require.NoError(t, cfg.Releases.Create(newRelease(2, release.StatusDeployed)))
+	require.NoError(t, cfg.Releases.Create(newRelease(3, release.StatusPendingUpgrade)))
+	// Helm supersedes the previous revision only when the upgrade has finished
+	time.AfterFunc(500*time.Millisecond, func() {
+		assert.NoError(t, cfg.Releases.Update(newRelease(2, release.StatusSuperseded)))
+		assert.NoError(t, cfg.Releases.Update(newRelease(3, release.StatusDeployed)))
+	})
+
+	changes, err := revisionChanges(context.Background(), cfg, "my-release", newDeadline(), &bytes.Buffer{})
+
+	require.NoError(t, err)
+	require.Equal(t, 3, changes.release.Version)
+	require.NotNil(t, changes.previous)
+	require.Equal(t, 2, changes.previous.Version)
+	require.Len(t, changes.changed, 1)
+}
+
+func TestRevisionChangesOfGivenRevisions(t *testing.T) {
+	var tests = []struct {
+		name     string
+		from     int
+		to       int
+		current  int
+		previous int
+		err      string
+	}{
+		{"Default", 0, 0, 4, 2, ""},
+		{"FromRevision", 1, 0, 4, 1, ""},
+		{"ToRevision", 0, 2, 2, 1, ""},
+		{"ToRevisionSkipsFailed", 0, 4, 4, 2, ""},
+		{"FromAndToRevision", 1, 2, 2, 1, ""},
+		{"UnknownFromRevision", 7, 0, 0, 0, "release my-release has no revision 7, available revisions: 1, 2, 3, 4"},
+		{"UnknownToRevision", 0, 7, 0, 0, "release my-release has no revision 7, available revisions: 1, 2, 3, 4"},
+		{"FromEqualsTo", 2, 2, 0, 0, "revision to compare from (2) must be older than revision to compare to (2)"},
+		{"FromNewerThanTo", 4, 2, 0, 0, "revision to compare from (4) must be older than revision to compare to (2)"},
+		{"FailedToRevision", 0, 3, 0, 0, "release my-release failed: version=3: "},
+	}
+	cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	require.NoError(t, cfg.Releases.Create(newRelease(1, release.StatusSuperseded)))
+	require.NoError(t, cfg.Releases.Create(newRelease(2, release.StatusSuperseded)))
+	require.NoError(t, cfg.Releases.Create(newRelease(3, release.StatusFailed)))
+	require.NoError(t, cfg.Releases.Create(newRelease(4, release.StatusDeployed)))
+	t.Cleanup(func() { fromRevision, toRevision = 0, 0 })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromRevision, toRevision = tt.from, tt.to
+
+			changes, err := revisionChanges(context.Background(), cfg, "my-release", newDeadline(), &bytes.Buffer{})
+
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.current, changes.release.Version)
+			require.Equal(t, tt.previous, changes.previous.Version)
+		})
+	}
+}
+
+func TestUpgradeRejectsNegativeRevisions(t *testing.T) {
+	t.Cleanup(func() { fromRevision, toRevision = 0, 0 })
+	fromRevision, toRevision = -1, 0
+	err := runUpgrade(&cobra.Command{}, []string{"my-release"})
+	require.EqualError(t, err, "--from-revision and --to-revision must be positive")
+	require.Equal(t, ExitConfig, ExitCode(err))
+
+	fromRevision, toRevision = 0, -2
+	require.EqualError(t, runUpgrade(&cobra.Command{}, []string{"my-release"}), "--from-revision and --to-revision must be positive")
+}
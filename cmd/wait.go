@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/common"
+	"github.com/dieler/helm-wait/pkg/diff"
+	"github.com/dieler/helm-wait/pkg/helm"
+	"github.com/dieler/helm-wait/pkg/kube"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"io"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	timeout           int64
+	maxRestarts       int32
+	failOnPaused      bool
+	waitForRemoved    bool
+	ignoredFinalizers []string
+	waitForPending    bool
+	outputFormat      string
+	junitReport       string
+	rawDiff           bool
+)
+
+// pendingPollInterval is the interval for polling the release storage while a release is pending
+const pendingPollInterval = 2 * time.Second
+
+const (
+	hookAnnotation = "helm.sh/hook"
+	// resourcePolicyAnnotation with the keep policy tells Helm to keep a resource on upgrade and uninstall
+	resourcePolicyAnnotation = "helm.sh/resource-policy"
+	keepPolicy               = "keep"
+)
+
+// addWaitFlags binds the flags shared by all commands waiting for resources to the given flagset.
+func addWaitFlags(fs *pflag.FlagSet) {
+	fs.Int64Var(&timeout, "timeout", 300, "time in seconds to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	fs.Int32Var(&maxRestarts, "max-restarts", 5, "number of container restarts tolerated for a crash looping pod before the wait fails")
+	fs.BoolVar(&failOnPaused, "fail-on-paused", false, "fail if a deployment is paused instead of skipping it")
+	fs.BoolVar(&waitForPending, "wait-for-pending", false, "wait until a pending release has finished, instead of failing immediately")
+	addOutputFlags(fs)
+}
+
+// addOutputFlags binds the flags for the output format and reports to the given flagset.
+func addOutputFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&outputFormat, "output", "o", outputText, "output format, one of text, json or yaml. With json or yaml, a structured report is printed to stdout and the progress to stderr")
+	fs.StringVar(&junitReport, "junit-report", "", "write a JUnit XML report with a test case per resource waited on to the given file")
+}
+
+// logOut returns the writer for human readable progress, which is stderr when a structured report is printed to stdout
+func logOut() io.Writer {
+	if outputFormat != outputText {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// addRemovedFlags binds the flags for waiting on the deletion of resources to the given flagset.
+func addRemovedFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&waitForRemoved, "wait-for-removed", false, "wait until resources removed from the release have been deleted as well")
+	addFinalizerFlags(fs)
+}
+
+// addDiffFlags binds the flags for comparing revisions to the given flagset.
+func addDiffFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&rawDiff, "raw-diff", false, "compare the rendered text of resources, so that changes of formatting, comments or key order are changes as well")
+}
+
+// addFinalizerFlags binds the flags for deleted resources blocked by finalizers to the given flagset.
+func addFinalizerFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&ignoredFinalizers, "ignore-finalizers", []string{}, "finalizers which do not block the deletion of a resource, i.e. a resource only blocked by these counts as deleted")
+}
+
+func newKubeClient(kubeConfig common.KubeConfig, out io.Writer) (*kube.Client, error) {
+	options := kube.WaitOptions{
+		MaxRestarts:       maxRestarts,
+		FailOnPaused:      failOnPaused,
+		IgnoredFinalizers: ignoredFinalizers,
+	}
+	kc, err := kube.New(helm.GetRESTClientGetter(kubeConfig), out, options)
+	return kc, asConfigError(err)
+}
+
+// getActionConfig returns the Helm action configuration, failing with a configuration error
+func getActionConfig(ctx context.Context, namespace string, kubeConfig common.KubeConfig) (*action.Configuration, error) {
+	cfg, err := helm.GetActionConfig(ctx, namespace, kubeConfig)
+	return cfg, asConfigError(err)
+}
+
+// deletedByHelm returns the given resources except hooks and those kept by their resource policy,
+// as Helm does not delete them on upgrade or uninstall
+func deletedByHelm(resources []*manifest.MappingResult) []*manifest.MappingResult {
+	var result []*manifest.MappingResult
+	for _, r := range resources {
+		annotations := r.Metadata.ObjectMeta.Annotations
+		if annotations[resourcePolicyAnnotation] == keepPolicy || annotations[hookAnnotation] != "" {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// getHistory returns the revisions of the given release sorted by their version
+func getHistory(cfg *action.Configuration, releaseName string) ([]*release.Release, error) {
+	history, err := cfg.Releases.History(releaseName)
+	if err != nil {
+		return nil, asConfigError(err)
+	}
+	releaseutil.SortByRevision(history)
+	return history, nil
+}
+
+// newDeadline returns the deadline shared by waiting for pending releases and for the resources of all releases
+func newDeadline() time.Time {
+	return time.Now().Add(time.Duration(timeout) * time.Second)
+}
+
+// awaitRelease polls the release storage until the given revision is not pending anymore or the deadline is reached, if waiting
+// for pending releases is enabled, and returns the finished revision or an error if it failed. Otherwise the given revision is returned.
+func awaitRelease(ctx context.Context, cfg *action.Configuration, rel *release.Release, deadline time.Time) (*release.Release, error) {
+	if !waitForPending || !rel.Info.Status.IsPending() {
+		return rel, nil
+	}
+	fmt.Fprintf(logOut(), "Waiting for pending release %s: version=%d, status=%s\n", rel.Name, rel.Version, rel.Info.Status)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	var storageErr error
+	err := wait.PollUntilContextCancel(ctx, pendingPollInterval, true, func(ctx context.Context) (bool, error) {
+		r, err := cfg.Releases.Get(rel.Name, rel.Version)
+		if err != nil {
+			storageErr = err
+			return false, err
+		}
+		rel = r
+		return !rel.Info.Status.IsPending(), nil
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	// The release storage cannot be accessed, which is no failure of the release
+	if storageErr != nil {
+		return nil, configErrorf("failed to get release %s version %d: %w", rel.Name, rel.Version, storageErr)
+	}
+	if err != nil {
+		return nil, releaseErrorf("release %s is still pending: version=%d, status=%s: %w", rel.Name, rel.Version, rel.Info.Status, err)
+	}
+	return rel, nil
+}
+
+// checkRelease returns an error if the given revision is pending or failed, as its resources may not have been applied
+func checkRelease(rel *release.Release) error {
+	switch {
+	case rel.Info.Status.IsPending():
+		return releaseErrorf("release %s is pending: version=%d, status=%s", rel.Name, rel.Version, rel.Info.Status)
+	case rel.Info.Status == release.StatusFailed:
+		return releaseErrorf("release %s failed: version=%d: %s", rel.Name, rel.Version, rel.Info.Description)
+	}
+	return nil
+}
+
+// findRevision returns the index of the given revision in the sorted history of a release
+func findRevision(history []*release.Release, releaseName string, revision int) (int, error) {
+	versions := make([]string, 0, len(history))
+	for i, r := range history {
+		if r.Version == revision {
+			return i, nil
+		}
+		versions = append(versions, strconv.Itoa(r.Version))
+	}
+	return -1, configErrorf("release %s has no revision %d, available revisions: %s", releaseName, revision, strings.Join(versions, ", "))
+}
+
+// checkManifest prints duplicate resources in the manifest of a release as a warning, as Helm applies only one of them,
+// and returns any other error of parsing the manifest
+func checkManifest(out io.Writer, rel *release.Release, err error) error {
+	var duplicates *manifest.DuplicateError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &duplicates):
+		fmt.Fprintf(out, "Warning: release %s revision %d: %v\n", rel.Name, rel.Version, err)
+		return nil
+	}
+	return fmt.Errorf("failed to parse manifest of release %s revision %d: %w", rel.Name, rel.Version, err)
+}
+
+// getChanges computes the changes between the previous and the current revision of a release.
+// Without a previous revision all resources are changed.
+func getChanges(previousRelease, currentRelease *release.Release, out io.Writer) (*releaseChanges, error) {
+	fmt.Fprintf(out, "Current release: %d\n", currentRelease.Version)
+	currentSpecs, err := manifest.ParseRelease(currentRelease, false)
+	if err = checkManifest(out, currentRelease, err); err != nil {
+		return nil, err
+	}
+	var previousSpecs map[string]*manifest.MappingResult
+	if previousRelease == nil {
+		previousSpecs = map[string]*manifest.MappingResult{}
+	} else {
+		fmt.Fprintf(out, "Previous release: %d\n", previousRelease.Version)
+		previousSpecs, err = manifest.ParseRelease(previousRelease, false)
+		if err = checkManifest(out, previousRelease, err); err != nil {
+			return nil, err
+		}
+	}
+	options := diff.Options{RawText: rawDiff}
+	changed, changes, err := diff.GetModifiedOrNewResources(previousSpecs, currentSpecs, out, options)
+	if err != nil {
+		return nil, err
+	}
+	var removed []*manifest.MappingResult
+	if waitForRemoved {
+		removed = deletedByHelm(diff.GetRemovedResources(previousSpecs, currentSpecs))
+	}
+	resources := make(map[string]*manifest.MappingResult, len(changes))
+	for name, change := range changes {
+		if change == diff.REMOVED {
+			resources[name] = previousSpecs[name]
+		} else {
+			resources[name] = currentSpecs[name]
+		}
+	}
+	return &releaseChanges{
+		release:   currentRelease,
+		previous:  previousRelease,
+		changes:   changes,
+		resources: resources,
+		changed:   changed,
+		removed:   removed,
+	}, nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"testing"
+	"time"
+)
+
+func TestAwaitReleaseUntilDeadline(t *testing.T) {
+	waitForPending, timeout = true, 300
+	t.Cleanup(func() { waitForPending, timeout = false, 300 })
+	cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	pending := newRelease(1, release.StatusPendingInstall)
+	require.NoError(t, cfg.Releases.Create(pending))
+
+	// The deadline shared with other releases ends the wait, not the timeout
+	start := time.Now()
+	_, err := awaitRelease(context.Background(), cfg, pending, start.Add(100*time.Millisecond))
+
+	require.EqualError(t, err, "release my-release is still pending: version=1, status=pending-install: context deadline exceeded")
+	require.Equal(t, ExitRelease, ExitCode(err))
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestAwaitReleaseOfMissingRelease(t *testing.T) {
+	waitForPending = true
+	t.Cleanup(func() { waitForPending = false })
+	cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+
+	_, err := awaitRelease(context.Background(), cfg, newRelease(1, release.StatusPendingInstall), newDeadline())
+
+	require.EqualError(t, err, "failed to get release my-release version 1: release: not found")
+	require.Equal(t, ExitConfig, ExitCode(err))
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/dieler/helm-wait/cmd"
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// Restore the default behavior, so that a second signal terminates immediately
+		<-ctx.Done()
+		stop()
+	}()
 	rootCmd := cmd.NewRootCmd(os.Stdout, os.Args[1:])
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -7,14 +7,34 @@ import (
 	"io"
 )
 
-func GetModifiedOrNewResources(previous, current map[string]*manifest.MappingResult, to io.Writer) ([]*manifest.MappingResult, error) {
+// GetModifiedOrNewResources prints the changes between the previous and the current revision and returns the changed
+// or added resources of the current revision together with the changes, so that they are only computed once
+func GetModifiedOrNewResources(previous, current map[string]*manifest.MappingResult, to io.Writer, options Options) ([]*manifest.MappingResult, map[string]Change, error) {
 	var result []*manifest.MappingResult
-	changes := make(map[string]change)
+	changes := GetChanges(previous, current, options)
+	for key, c := range changes {
+		if c != REMOVED {
+			result = append(result, current[key])
+		}
+	}
+	if len(changes) > 0 {
+		fmt.Fprintf(to, "Changes:\n")
+		for k, v := range changes {
+			fprintf(to, v.color(), v.format(), k)
+		}
+	} else {
+		fmt.Fprintf(to, "No changes\n")
+	}
+	return result, changes, nil
+}
+
+// GetChanges returns the change of every resource which differs between the previous and the current revision
+func GetChanges(previous, current map[string]*manifest.MappingResult, options Options) map[string]Change {
+	changes := make(map[string]Change)
 	for key, previousValue := range previous {
 		if currentValue, ok := current[key]; ok {
-			if previousValue.Content != currentValue.Content {
+			if !equal(previousValue.Content, currentValue.Content, options) {
 				changes[key] = CHANGED
-				result = append(result, currentValue)
 			}
 		} else {
 			changes[key] = REMOVED
@@ -23,18 +43,20 @@ func GetModifiedOrNewResources(previous, current map[string]*manifest.MappingRes
 	for key := range current {
 		if _, ok := previous[key]; !ok {
 			changes[key] = ADDED
-			result = append(result, current[key])
 		}
 	}
-	if len(changes) > 0 {
-		fmt.Fprintf(to, "Changes:\n")
-		for k, v := range changes {
-			fprintf(to, v.color(), v.format(), k)
+	return changes
+}
+
+// GetRemovedResources returns the resources of the previous revision which do not exist in the current revision anymore
+func GetRemovedResources(previous, current map[string]*manifest.MappingResult) []*manifest.MappingResult {
+	var result []*manifest.MappingResult
+	for key, previousValue := range previous {
+		if _, ok := current[key]; !ok {
+			result = append(result, previousValue)
 		}
-	} else {
-		fmt.Fprintf(to, "No changes\n")
 	}
-	return result, nil
+	return result
 }
 
 func fprintf(to io.Writer, color, format string, args ...interface{}) {
@@ -44,18 +66,23 @@ func fprintf(to io.Writer, color, format string, args ...interface{}) {
 	}
 }
 
-type change int
+// Change is the kind of change of a resource between two revisions
+type Change int
 
 const (
-	ADDED change = iota
+	ADDED Change = iota
 	CHANGED
 	REMOVED
 )
 
-func (c change) color() string {
+func (c Change) String() string {
+	return [...]string{"ADDED", "CHANGED", "REMOVED"}[c]
+}
+
+func (c Change) color() string {
 	return [...]string{"green", "yellow", "red"}[c]
 }
 
-func (c change) format() string {
+func (c Change) format() string {
 	return [...]string{"++ %s", "~~ %s", "-- %s"}[c]
 }
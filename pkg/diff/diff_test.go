@@ -2,9 +2,11 @@ package diff
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/dieler/helm-wait/pkg/manifest"
 	"github.com/mgutz/ansi"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -107,12 +109,112 @@ metadata:
 		t.Run(tt.name, func(t *testing.T) {
 			ansi.DisableColors(true)
 			var buf bytes.Buffer
-			_, err := GetModifiedOrNewResources(tt.previous, tt.current, &buf)
+			_, changes, err := GetModifiedOrNewResources(tt.previous, tt.current, &buf, Options{})
 			if err != nil {
 				t.Errorf("Unexpected error: %s", err)
 			}
 			require.Equal(t, tt.expected, buf.String())
+			require.Equal(t, GetChanges(tt.previous, tt.current, Options{}), changes)
 		})
 
 	}
 }
+
+func TestGetRemovedResources(t *testing.T) {
+	nginx := &manifest.MappingResult{Name: "nginx, nginx, Deployment (apps)"}
+	redis := &manifest.MappingResult{Name: "nginx, redis, StatefulSet (apps)"}
+	previous := map[string]*manifest.MappingResult{nginx.Name: nginx, redis.Name: redis}
+	current := map[string]*manifest.MappingResult{nginx.Name: nginx}
+
+	require.Equal(t, []*manifest.MappingResult{redis}, GetRemovedResources(previous, current))
+	require.Empty(t, GetRemovedResources(current, previous))
+}
+
+func TestGetChangesIgnoresFormatting(t *testing.T) {
+	previous := `# Source: chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels: {app: nginx, tier: web}
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.25
+        ports:
+        - containerPort: 80
+        resources:
+          limits:
+            cpu: 0.5
+`
+	var tests = []struct {
+		name     string
+		current  string
+		semantic map[string]Change
+		raw      map[string]Change
+	}{
+		{"Unchanged", previous, map[string]Change{}, map[string]Change{}},
+		{"Reformatted", `# Source: chart/templates/nginx.yaml
+kind: Deployment
+apiVersion: "apps/v1"
+metadata:
+  labels:
+    tier: web
+    app: nginx
+  name: nginx   # the web server
+spec:
+  replicas: "2"
+  template:
+    spec:
+      containers:
+        - name: nginx
+          image: 'nginx:1.25'
+          ports:
+            - containerPort: 80.0
+          resources:
+            limits:
+              cpu: 5e-1
+`, map[string]Change{}, map[string]Change{"nginx": CHANGED}},
+		{"Scaled", strings.Replace(previous, "replicas: 2", "replicas: 3", 1), map[string]Change{"nginx": CHANGED}, map[string]Change{"nginx": CHANGED}},
+		{"ImageChangedAndKeysReordered", strings.Replace(previous, "- name: nginx\n        image: nginx:1.25", "- image: nginx:1.26\n        name: nginx", 1), map[string]Change{"nginx": CHANGED}, map[string]Change{"nginx": CHANGED}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := map[string]*manifest.MappingResult{"nginx": {Content: previous}}
+			c := map[string]*manifest.MappingResult{"nginx": {Content: tt.current}}
+			require.Equal(t, tt.semantic, GetChanges(p, c, Options{}))
+			require.Equal(t, tt.raw, GetChanges(p, c, Options{RawText: true}))
+		})
+	}
+}
+
+func TestEqualScalars(t *testing.T) {
+	var tests = []struct {
+		previous string
+		current  string
+		expected bool
+	}{
+		{`2`, `"2"`, true},
+		{`nginx:1.25`, `'nginx:1.25'`, true},
+		{`true`, `"true"`, true},
+		{`80`, `80.0`, true},
+		{`0.5`, `5e-1`, true},
+		{`"1.10"`, `"1.1"`, false},
+		{`"1.0"`, `"1"`, false},
+		{`"010"`, `"8"`, false},
+		{`"010"`, `8`, false},
+		{`1.10`, `"1.1"`, false},
+		{`80.0`, `"80"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s=%s", tt.previous, tt.current), func(t *testing.T) {
+			previous := fmt.Sprintf("data:\n  version: %s\n", tt.previous)
+			current := fmt.Sprintf("data:\n  version: %s\n", tt.current)
+			require.Equal(t, tt.expected, equal(previous, current, Options{}))
+			require.Equal(t, tt.expected, equal(current, previous, Options{}))
+		})
+	}
+}
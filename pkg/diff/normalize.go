@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Options tune how the contents of a resource in two revisions are compared
+type Options struct {
+	// RawText compares the rendered text of resources, so that any change of formatting or comments is a change
+	RawText bool
+}
+
+// equal returns true if the given contents of a resource are equal. Unless raw text is compared, they are equal
+// if their normalized object trees are, falling back to the raw text if one of them cannot be parsed.
+func equal(previous, current string, options Options) bool {
+	if options.RawText || previous == current {
+		return previous == current
+	}
+	previousTree, err := normalize(previous)
+	if err != nil {
+		return false
+	}
+	currentTree, err := normalize(current)
+	if err != nil {
+		return false
+	}
+	return equalTrees(previousTree, currentTree)
+}
+
+// scalar is a normalized scalar. A plain scalar holds its value in a canonical notation, so that 80 and 80.0 are equal.
+// A quoted scalar is a string whose text is never rewritten, so that it only equals a scalar with the same text,
+// e.g. "2" equals 2, but "1.10" differs from "1.1" and "010" from 8.
+type scalar struct {
+	text   string
+	quoted bool
+	value  interface{}
+}
+
+// normalize parses YAML content into an object tree with comments stripped, maps with string keys, which compare
+// independent of their order, aliases and merge keys resolved, and scalars which compare independent of their notation,
+// so that contents which only differ in formatting compare equal
+func normalize(content string) (interface{}, error) {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal([]byte(content), &document); err != nil {
+		return nil, err
+	}
+	if document.Kind != yamlv3.DocumentNode || len(document.Content) == 0 {
+		return nil, nil
+	}
+	return normalizeNode(document.Content[0]), nil
+}
+
+func normalizeNode(n *yamlv3.Node) interface{} {
+	switch n.Kind {
+	case yamlv3.AliasNode:
+		return normalizeNode(n.Alias)
+	case yamlv3.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		var merged []interface{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Tag == "!!merge" {
+				merged = append(merged, normalizeNode(value))
+				continue
+			}
+			m[key.Value] = normalizeNode(value)
+		}
+		// Keys of the map itself override merged ones, earlier merged maps override later ones
+		for _, item := range merged {
+			maps, ok := item.([]interface{})
+			if !ok {
+				maps = []interface{}{item}
+			}
+			for _, mergedMap := range maps {
+				entries, _ := mergedMap.(map[string]interface{})
+				for key, value := range entries {
+					if _, ok := m[key]; !ok {
+						m[key] = value
+					}
+				}
+			}
+		}
+		return m
+	case yamlv3.SequenceNode:
+		list := make([]interface{}, len(n.Content))
+		for i, item := range n.Content {
+			list[i] = normalizeNode(item)
+		}
+		return list
+	case yamlv3.ScalarNode:
+		if n.Style&(yamlv3.DoubleQuotedStyle|yamlv3.SingleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0 {
+			return scalar{text: n.Value, quoted: true}
+		}
+		return scalar{text: n.Value, value: plainValue(n.Value)}
+	}
+	return nil
+}
+
+// plainValue returns the value of a plain scalar in a canonical notation, as YAML parses it for Kubernetes
+func plainValue(text string) interface{} {
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(text), &value); err != nil {
+		return text
+	}
+	switch v := value.(type) {
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return formatFloat(v)
+	case string, bool, nil:
+		return v
+	}
+	return text
+}
+
+// equalTrees returns true if the given normalized object trees are equal
+func equalTrees(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equalTrees(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalTrees(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case scalar:
+		y, ok := b.(scalar)
+		if !ok {
+			return false
+		}
+		if x.quoted || y.quoted {
+			return x.text == y.text
+		}
+		return reflect.DeepEqual(x.value, y.value)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// formatFloat formats integral floats like integers, so that 1.0 and 1 are equal
+func formatFloat(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
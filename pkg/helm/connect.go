@@ -1,6 +1,7 @@
 package helm
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,21 +9,22 @@ import (
 	"github.com/dieler/helm-wait/pkg/common"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/cli"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
 var (
 	settings = cli.New()
 )
 
-// GetActionConfig returns action configuration based on Helm env
-func GetActionConfig(namespace string, kubeConfig common.KubeConfig) (*action.Configuration, error) {
+// GetActionConfig returns action configuration based on Helm env. As the Helm actions cannot be canceled,
+// an error is returned if the given context is already done.
+func GetActionConfig(ctx context.Context, namespace string, kubeConfig common.KubeConfig) (*action.Configuration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	actionConfig := new(action.Configuration)
 
-	// Add kube config settings passed by user
-	settings.KubeConfig = kubeConfig.File
-	settings.KubeContext = kubeConfig.Context
-
-	err := actionConfig.Init(settings.RESTClientGetter(), namespace, os.Getenv("HELM_DRIVER"), debug)
+	err := actionConfig.Init(GetRESTClientGetter(kubeConfig), namespace, os.Getenv("HELM_DRIVER"), debug)
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +32,28 @@ func GetActionConfig(namespace string, kubeConfig common.KubeConfig) (*action.Co
 	return actionConfig, err
 }
 
+// GetRESTClientGetter returns the REST client getter based on Helm env, i.e. it honors
+// KUBECONFIG, HELM_KUBECONTEXT, HELM_KUBEAPISERVER, HELM_KUBETOKEN, impersonation and in-cluster config
+func GetRESTClientGetter(kubeConfig common.KubeConfig) genericclioptions.RESTClientGetter {
+	// Add kube config settings passed by user, otherwise keep the ones from the Helm env
+	if kubeConfig.File != "" {
+		settings.KubeConfig = kubeConfig.File
+	}
+	if kubeConfig.Context != "" {
+		settings.KubeContext = kubeConfig.Context
+	}
+	return settings.RESTClientGetter()
+}
+
+// GetNamespace returns the namespace based on Helm env, i.e. HELM_NAMESPACE or else the namespace of the kube context
+func GetNamespace(kubeConfig common.KubeConfig) string {
+	namespace, _, err := GetRESTClientGetter(kubeConfig).ToRawKubeConfigLoader().Namespace()
+	if err != nil || namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
 func debug(format string, v ...interface{}) {
 	if settings.Debug {
 		format = fmt.Sprintf("[debug] %s\n", format)
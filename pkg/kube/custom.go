@@ -0,0 +1,57 @@
+package kube
+
+import (
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// builtInGroups are the API groups served by the Kubernetes API server which are not part of the client-go scheme
+var builtInGroups = map[string]bool{"apiextensions.k8s.io": true, "apiregistration.k8s.io": true}
+
+// isDynamicResource returns true if the resource does not belong to a built-in API group of Kubernetes, i.e. it is
+// a custom resource or one of an aggregated API, so that it is resolved through the RESTMapper and checked by its
+// status conditions. Built-in kinds other than the workloads with a typed readiness check are not waited on.
+func isDynamicResource(r *manifest.MappingResult) bool {
+	gv, err := schema.ParseGroupVersion(r.Metadata.APIVersion)
+	if err != nil {
+		return false
+	}
+	return !scheme.Scheme.IsGroupRegistered(gv.Group) && !builtInGroups[gv.Group]
+}
+
+// customResourceReady checks the status of a custom resource following the conventions of kstatus:
+// the controller must have observed the current generation, a Stalled condition aborts the wait,
+// a Reconciling condition means it is still in progress, and a Ready or else an Available condition must be true.
+// Resources without any of these are considered ready.
+func customResourceReady(obj *unstructured.Unstructured) (bool, error) {
+	observedGeneration, found, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if err == nil && found && observedGeneration < obj.GetGeneration() {
+		return false, nil
+	}
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, nil
+	}
+	statuses := make(map[string]map[string]interface{})
+	for _, c := range conditions {
+		if condition, ok := c.(map[string]interface{}); ok {
+			if conditionType, ok := condition["type"].(string); ok {
+				statuses[conditionType] = condition
+			}
+		}
+	}
+	if stalled, ok := statuses["Stalled"]; ok && stalled["status"] == "True" {
+		return false, failedf("%s is stalled: %s/%s: %v: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), stalled["reason"], stalled["message"])
+	}
+	if reconciling, ok := statuses["Reconciling"]; ok && reconciling["status"] == "True" {
+		return false, nil
+	}
+	for _, conditionType := range []string{"Ready", "Available"} {
+		if condition, ok := statuses[conditionType]; ok {
+			return condition["status"] == "True", nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"strings"
+	"time"
+)
+
+// WaitForDeletion watches all given resources until they have been deleted or a timeout is reached.
+// Resources whose deletion is blocked by finalizers are reported, unless all of them are ignored.
+// The results of all resources are returned even if the wait failed, with diagnostics of the resources which are not deleted.
+// If the given context is canceled, its error is returned and no diagnostics are collected.
+func (c *Client) WaitForDeletion(ctx context.Context, timeout time.Duration, resources []*manifest.MappingResult) ([]Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	w, err := newDeletionWatcher(c, resources)
+	if err != nil {
+		return nil, err
+	}
+	err = w.wait(ctx, c.resourceDeleted(w), c.deletionProgress(w))
+	results := w.Results()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		c.diagnose(results)
+	}
+	return results, err
+}
+
+// resourceDeleted returns a check which looks up whether a resource still exists in the watch caches
+func (c *Client) resourceDeleted(w *watcher) readyFunc {
+	return func(r *manifest.MappingResult) (bool, error) {
+		if !w.watched(r) {
+			return true, nil
+		}
+		obj, err := w.getDynamic(r)
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if obj.GetDeletionTimestamp() != nil && len(obj.GetFinalizers()) > 0 {
+			blocking := c.blockingFinalizers(obj.GetFinalizers())
+			if len(blocking) == 0 {
+				return true, nil
+			}
+			w.notice(r, "%s is blocked by finalizers [%s]: %s/%s\n", r.Metadata.Kind, strings.Join(blocking, ", "), r.Metadata.ObjectMeta.Namespace, r.Metadata.ObjectMeta.Name)
+		}
+		return false, nil
+	}
+}
+
+// blockingFinalizers returns the given finalizers which are not ignored
+func (c *Client) blockingFinalizers(finalizers []string) []string {
+	var blocking []string
+	for _, finalizer := range finalizers {
+		ignored := false
+		for _, f := range c.options.IgnoredFinalizers {
+			if f == finalizer {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			blocking = append(blocking, finalizer)
+		}
+	}
+	return blocking
+}
@@ -0,0 +1,231 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// diagnoseTimeout limits the time for collecting diagnostics, as the wait has already ended
+	diagnoseTimeout = 30 * time.Second
+	// maxDiagnosedPods is the number of pods of a workload which are diagnosed, as all of them mostly fail for the same reason
+	maxDiagnosedPods = 3
+	// logTailLines is the number of log lines collected of a failing container
+	logTailLines = 20
+)
+
+// Diagnostics are collected for a resource which failed or was not ready or deleted when the wait ended
+type Diagnostics struct {
+	// Events are the warning events of the resource
+	Events []Event `json:"events,omitempty"`
+	// Pods are the pods of a workload which are not ready
+	Pods []PodDiagnostics `json:"pods,omitempty"`
+	// Errors are the errors which occurred while collecting the diagnostics
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Event is a warning event reported for a resource or pod
+type Event struct {
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// PodDiagnostics are the warning events and container statuses of a pod which is not ready
+type PodDiagnostics struct {
+	Name       string                 `json:"name"`
+	Phase      string                 `json:"phase"`
+	Events     []Event                `json:"events,omitempty"`
+	Containers []ContainerDiagnostics `json:"containers"`
+}
+
+// ContainerDiagnostics are the status of a container which is not ready and the tail of its log if it terminated
+type ContainerDiagnostics struct {
+	Name            string `json:"name"`
+	RestartCount    int32  `json:"restartCount"`
+	State           string `json:"state"`
+	LastTermination string `json:"lastTermination,omitempty"`
+	Logs            string `json:"logs,omitempty"`
+}
+
+// diagnose collects the diagnostics of all results which are not ready or deleted. Errors collecting them
+// are added to the diagnostics instead of being returned, as they must not hide the reason why the wait failed.
+func (c *Client) diagnose(results []Result) {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	defer cancel()
+	for i := range results {
+		if results[i].Status == StatusFailed || results[i].Status == StatusPending {
+			results[i].Diagnostics = c.diagnoseResource(ctx, results[i].Resource)
+		}
+	}
+}
+
+func (c *Client) diagnoseResource(ctx context.Context, r *manifest.MappingResult) *Diagnostics {
+	namespace, name := r.Metadata.ObjectMeta.Namespace, r.Metadata.ObjectMeta.Name
+	d := &Diagnostics{}
+	d.Events = c.warningEvents(ctx, d, namespace, r.Metadata.Kind, name)
+	selector, err := c.podSelector(ctx, r)
+	if err != nil {
+		d.Errors = append(d.Errors, err.Error())
+		return d
+	}
+	if selector == nil {
+		return d
+	}
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(selector)})
+	if err != nil {
+		d.Errors = append(d.Errors, err.Error())
+		return d
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if podReady(pod) || pod.Status.Phase == v1.PodSucceeded {
+			continue
+		}
+		if len(d.Pods) == maxDiagnosedPods {
+			break
+		}
+		d.Pods = append(d.Pods, c.diagnosePod(ctx, d, pod))
+	}
+	return d
+}
+
+// podSelector returns the selector of the pods of a workload, or nil for other resources
+func (c *Client) podSelector(ctx context.Context, r *manifest.MappingResult) (*metav1.LabelSelector, error) {
+	namespace, name := r.Metadata.ObjectMeta.Namespace, r.Metadata.ObjectMeta.Name
+	if isDynamicResource(r) {
+		return nil, nil
+	}
+	switch r.Metadata.Kind {
+	case "Deployment":
+		d, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, ignoreNotFound(err)
+		}
+		return d.Spec.Selector, nil
+	case "StatefulSet":
+		sf, err := c.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, ignoreNotFound(err)
+		}
+		return sf.Spec.Selector, nil
+	case "DaemonSet":
+		ds, err := c.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, ignoreNotFound(err)
+		}
+		return ds.Spec.Selector, nil
+	case "Job":
+		job, err := c.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, ignoreNotFound(err)
+		}
+		return job.Spec.Selector, nil
+	}
+	return nil, nil
+}
+
+// warningEvents returns the warning events of the given object, the most recent one last
+func (c *Client) warningEvents(ctx context.Context, d *Diagnostics, namespace, kind, name string) []Event {
+	selector := fields.Set{"involvedObject.kind": kind, "involvedObject.name": name, "type": v1.EventTypeWarning}.AsSelector()
+	list, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		d.Errors = append(d.Errors, err.Error())
+		return nil
+	}
+	var events []Event
+	for _, e := range list.Items {
+		// Field selectors are not supported by all API servers, so filter again
+		if e.Type != v1.EventTypeWarning || e.InvolvedObject.Kind != kind || e.InvolvedObject.Name != name {
+			continue
+		}
+		lastSeen := e.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = e.EventTime.Time
+		}
+		events = append(events, Event{Reason: e.Reason, Message: e.Message, Count: e.Count, LastSeen: lastSeen})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].LastSeen.Before(events[j].LastSeen) })
+	return events
+}
+
+// diagnosePod collects the warning events and the status of all containers which are not ready,
+// including the tail of the log of containers which terminated or are restarting
+func (c *Client) diagnosePod(ctx context.Context, diagnostics *Diagnostics, pod *v1.Pod) PodDiagnostics {
+	d := PodDiagnostics{
+		Name:   pod.Name,
+		Phase:  string(pod.Status.Phase),
+		Events: c.warningEvents(ctx, diagnostics, pod.Namespace, "Pod", pod.Name),
+	}
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Ready || (status.State.Terminated != nil && status.State.Terminated.ExitCode == 0) {
+			continue
+		}
+		container := ContainerDiagnostics{
+			Name:         status.Name,
+			RestartCount: status.RestartCount,
+			State:        describeState(status.State),
+		}
+		if status.LastTerminationState.Terminated != nil {
+			container.LastTermination = describeState(status.LastTerminationState)
+		}
+		if status.State.Terminated != nil || status.LastTerminationState.Terminated != nil {
+			container.Logs = c.tailLogs(ctx, pod, status.Name, status.State.Terminated == nil)
+		}
+		d.Containers = append(d.Containers, container)
+	}
+	return d
+}
+
+// tailLogs returns the last lines of the log of the given container, of its previous instance if it is restarting
+func (c *Client) tailLogs(ctx context.Context, pod *v1.Pod, container string, previous bool) string {
+	tailLines := int64(logTailLines)
+	options := &v1.PodLogOptions{Container: container, Previous: previous, TailLines: &tailLines}
+	logs, err := c.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).DoRaw(ctx)
+	if err != nil {
+		return fmt.Sprintf("failed to get logs: %v", err)
+	}
+	return strings.TrimRight(string(logs), "\n")
+}
+
+// describeState describes the state of a container like kubectl does
+func describeState(state v1.ContainerState) string {
+	switch {
+	case state.Waiting != nil:
+		return joinNonEmpty("Waiting", state.Waiting.Reason, state.Waiting.Message)
+	case state.Terminated != nil:
+		return joinNonEmpty("Terminated", state.Terminated.Reason, fmt.Sprintf("exit code %d", state.Terminated.ExitCode), state.Terminated.Message)
+	case state.Running != nil:
+		return "Running"
+	}
+	return "Unknown"
+}
+
+func joinNonEmpty(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ": ")
+}
+
+// podReady returns true if the pod has a Ready condition which is true
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
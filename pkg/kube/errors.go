@@ -0,0 +1,18 @@
+package kube
+
+import "fmt"
+
+// FailedError is returned if a resource failed and will not become ready without a change of its spec,
+// e.g. a failed job, a crash looping pod, a deployment which exceeded its progress deadline or a stalled custom resource
+type FailedError struct {
+	Message string
+}
+
+func (e *FailedError) Error() string {
+	return e.Message
+}
+
+// failedf returns a FailedError with the formatted message
+func failedf(format string, args ...interface{}) error {
+	return &FailedError{Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,73 @@
+package kube
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+// waitingReasons are the reasons of waiting containers which will not recover without a change of the spec
+var waitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"CreateContainerConfigError": true,
+	"InvalidImageName":           true,
+}
+
+// listOwnedPods returns the pods matching the given selector and additional labels which are controlled by the given owner
+func listOwnedPods(lister corelisters.PodLister, owner metav1.Object, labelSelector *metav1.LabelSelector, extraLabels map[string]string) ([]*v1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	if len(extraLabels) > 0 {
+		requirements, _ := labels.SelectorFromSet(extraLabels).Requirements()
+		selector = selector.Add(requirements...)
+	}
+	all, err := lister.Pods(owner.GetNamespace()).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	owned := make([]*v1.Pod, 0, len(all))
+	for _, pod := range all {
+		if metav1.IsControlledBy(pod, owner) {
+			owned = append(owned, pod)
+		}
+	}
+	return owned, nil
+}
+
+// checkPods returns an error for the first pod which is in an unrecoverable state
+func (c *Client) checkPods(pods []*v1.Pod) error {
+	for _, pod := range pods {
+		if err := c.checkPod(pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPod returns an error naming the pod, container and reason if the pod cannot be scheduled
+// or one of its containers is waiting for a reason which requires a change of the spec.
+// Crash looping containers are tolerated until they exceed the maximum number of restarts.
+func (c *Client) checkPod(pod *v1.Pod) error {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+			return failedf("pod %s/%s is unschedulable: %s", pod.Namespace, pod.Name, condition.Message)
+		}
+	}
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		waiting := status.State.Waiting
+		if waiting == nil || !waitingReasons[waiting.Reason] {
+			continue
+		}
+		if waiting.Reason == "CrashLoopBackOff" && status.RestartCount <= c.options.MaxRestarts {
+			continue
+		}
+		return failedf("pod %s/%s container %s: %s: %s (restarts: %d)", pod.Namespace, pod.Name, status.Name, waiting.Reason, waiting.Message, status.RestartCount)
+	}
+	return nil
+}
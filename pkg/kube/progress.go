@@ -0,0 +1,110 @@
+package kube
+
+import (
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strings"
+)
+
+// progressFunc returns the last observed progress of a resource which is not yet ready
+type progressFunc func(r *manifest.MappingResult) Progress
+
+// resourceProgress returns the progress of a resource as found in the watch caches
+func (c *Client) resourceProgress(w *watcher) progressFunc {
+	return func(r *manifest.MappingResult) Progress {
+		namespace, name := r.Metadata.ObjectMeta.Namespace, r.Metadata.ObjectMeta.Name
+		if isDynamicResource(r) {
+			obj, err := w.getDynamic(r)
+			if err != nil {
+				return describeError(err)
+			}
+			return Progress{Message: customResourceStatus(obj)}
+		}
+		factory := w.factory(namespace)
+		switch r.Metadata.Kind {
+		case "Deployment":
+			d, err := factory.Apps().V1().Deployments().Lister().Deployments(namespace).Get(name)
+			if err != nil {
+				return describeError(err)
+			}
+			return Progress{Replicas: &Replicas{Ready: d.Status.ReadyReplicas, Desired: replicas(d.Spec.Replicas), Updated: d.Status.UpdatedReplicas}}
+		case "StatefulSet":
+			sf, err := factory.Apps().V1().StatefulSets().Lister().StatefulSets(namespace).Get(name)
+			if err != nil {
+				return describeError(err)
+			}
+			return Progress{Replicas: &Replicas{Ready: sf.Status.ReadyReplicas, Desired: replicas(sf.Spec.Replicas), Updated: sf.Status.UpdatedReplicas}}
+		case "DaemonSet":
+			ds, err := factory.Apps().V1().DaemonSets().Lister().DaemonSets(namespace).Get(name)
+			if err != nil {
+				return describeError(err)
+			}
+			return Progress{Replicas: &Replicas{Ready: ds.Status.NumberReady, Desired: ds.Status.DesiredNumberScheduled, Updated: ds.Status.UpdatedNumberScheduled}}
+		case "Job":
+			job, err := factory.Batch().V1().Jobs().Lister().Jobs(namespace).Get(name)
+			if err != nil {
+				return describeError(err)
+			}
+			// The pod template of a job is immutable, so all of its pods are updated
+			return Progress{
+				Replicas: &Replicas{Ready: job.Status.Succeeded, Desired: replicas(job.Spec.Completions), Updated: job.Status.Active + job.Status.Succeeded},
+				Message:  fmt.Sprintf("%d active, %d failed", job.Status.Active, job.Status.Failed),
+			}
+		}
+		return Progress{}
+	}
+}
+
+// deletionProgress returns the progress of a resource which has not been deleted yet
+func (c *Client) deletionProgress(w *watcher) progressFunc {
+	return func(r *manifest.MappingResult) Progress {
+		obj, err := w.getDynamic(r)
+		if err != nil {
+			return describeError(err)
+		}
+		if obj.GetDeletionTimestamp() == nil {
+			return Progress{Message: "not marked for deletion"}
+		}
+		if blocking := c.blockingFinalizers(obj.GetFinalizers()); len(blocking) > 0 {
+			return Progress{Message: fmt.Sprintf("blocked by finalizers [%s]", strings.Join(blocking, ", "))}
+		}
+		return Progress{Message: "terminating"}
+	}
+}
+
+// customResourceStatus returns the reason and message of the condition which keeps a custom resource from being ready
+func customResourceStatus(obj *unstructured.Unstructured) string {
+	observedGeneration, found, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if err == nil && found && observedGeneration < obj.GetGeneration() {
+		return fmt.Sprintf("generation %d not yet observed", obj.GetGeneration())
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, conditionType := range []string{"Reconciling", "Ready", "Available"} {
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != conditionType {
+				continue
+			}
+			return fmt.Sprintf("%s=%v: %v: %v", conditionType, condition["status"], condition["reason"], condition["message"])
+		}
+	}
+	return ""
+}
+
+// describeError describes a resource which could not be looked up, which is mostly one not yet in the watch cache
+func describeError(err error) Progress {
+	if apierrors.IsNotFound(err) {
+		return Progress{Message: "not found"}
+	}
+	return Progress{Message: err.Error()}
+}
+
+// replicas returns the desired number of replicas, which defaults to one
+func replicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
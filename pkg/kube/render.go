@@ -0,0 +1,147 @@
+package kube
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// refreshInterval is the interval in which the elapsed time of pending resources is rendered between events
+const refreshInterval = time.Second
+
+// renderer shows the progress of the resources waited on
+type renderer interface {
+	// transition is called whenever the status of a resource changed
+	transition(w *watcher, result Result)
+	// refresh is called after all resources have been checked and periodically in between
+	refresh(w *watcher)
+	// log prints a line about a resource which is not part of its progress
+	log(line string)
+}
+
+// newRenderer returns a renderer which refreshes a table of all resources in place on a terminal,
+// and otherwise one which only prints the transitions of resources, so that logs are not flooded
+func newRenderer(out io.Writer) renderer {
+	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		width, _, err := term.GetSize(int(f.Fd()))
+		if err != nil {
+			width = 0
+		}
+		return &tableRenderer{out: out, width: width}
+	}
+	return &transitionRenderer{out: out}
+}
+
+// transitionRenderer prints a line whenever the status of a resource changed
+type transitionRenderer struct {
+	out io.Writer
+}
+
+func (t *transitionRenderer) transition(w *watcher, result Result) {
+	metadata := result.Resource.Metadata
+	switch result.Status {
+	case StatusPending:
+		fmt.Fprintf(t.out, "%s is not %s: %s/%s", metadata.Kind, w.done, metadata.ObjectMeta.Namespace, metadata.ObjectMeta.Name)
+		if result.Message != "" {
+			fmt.Fprintf(t.out, " (%s)", result.Message)
+		}
+		fmt.Fprintln(t.out)
+	case StatusFailed:
+		fmt.Fprintf(t.out, "%s failed after %s: %s/%s\n", metadata.Kind, elapsed(result.Duration), metadata.ObjectMeta.Namespace, metadata.ObjectMeta.Name)
+	default:
+		fmt.Fprintf(t.out, "%s is %s after %s: %s/%s\n", metadata.Kind, result.Status, elapsed(result.Duration), metadata.ObjectMeta.Namespace, metadata.ObjectMeta.Name)
+	}
+}
+
+func (t *transitionRenderer) refresh(w *watcher) {}
+
+func (t *transitionRenderer) log(line string) {
+	fmt.Fprint(t.out, line)
+}
+
+// tableRenderer redraws a table of all resources in place. Lines are cut to the width of the terminal,
+// as wrapped lines would break moving the cursor back to the start of the table.
+type tableRenderer struct {
+	out   io.Writer
+	width int
+	table []byte
+	lines int
+}
+
+func (t *tableRenderer) transition(w *watcher, result Result) {}
+
+func (t *tableRenderer) refresh(w *watcher) {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tREADY\tUPDATED\tELAPSED\tSTATUS\tMESSAGE")
+	for _, r := range w.resources {
+		result := Result{Resource: r, Status: StatusPending, Duration: time.Since(w.start)}
+		if recorded, ok := w.results[r.Name]; ok {
+			result = *recorded
+			if result.Status == StatusPending {
+				result.Duration = time.Since(w.start)
+			}
+		}
+		ready, updated := "-", "-"
+		if replicas := result.Progress.Replicas; replicas != nil {
+			ready = fmt.Sprintf("%d/%d", replicas.Ready, replicas.Desired)
+			updated = fmt.Sprint(replicas.Updated)
+		}
+		// The message of a pending resource repeats its counts
+		message := result.Message
+		if result.Status == StatusPending {
+			message = result.Progress.Message
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Metadata.Kind, r.Metadata.ObjectMeta.Namespace, r.Metadata.ObjectMeta.Name,
+			ready, updated, elapsed(result.Duration), result.Status, message)
+	}
+	_ = tw.Flush()
+	t.clear()
+	t.table = t.cut(buf.Bytes())
+	t.draw()
+}
+
+func (t *tableRenderer) log(line string) {
+	t.clear()
+	fmt.Fprint(t.out, line)
+	t.draw()
+}
+
+// clear moves the cursor to the start of the table and erases it
+func (t *tableRenderer) clear() {
+	if t.lines > 0 {
+		fmt.Fprintf(t.out, "\x1b[%dA\x1b[J", t.lines)
+	}
+	t.lines = 0
+}
+
+func (t *tableRenderer) draw() {
+	_, _ = t.out.Write(t.table)
+	t.lines = bytes.Count(t.table, []byte("\n"))
+}
+
+// cut cuts all lines of the table to the width of the terminal
+func (t *tableRenderer) cut(table []byte) []byte {
+	if t.width <= 0 {
+		return table
+	}
+	lines := strings.SplitAfter(string(table), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\n")
+		if runes := []rune(line); len(runes) > t.width {
+			lines[i] = string(runes[:t.width]) + "\n"
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// elapsed formats a duration rounded to seconds
+func elapsed(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"time"
+)
+
+// Status is the outcome of waiting for a single resource
+type Status string
+
+const (
+	StatusReady   Status = "ready"
+	StatusDeleted Status = "deleted"
+	StatusFailed  Status = "failed"
+	// StatusPending means the resource was neither ready nor deleted when the wait ended
+	StatusPending Status = "pending"
+)
+
+// Result is the outcome of waiting for a single resource
+type Result struct {
+	Resource *manifest.MappingResult
+	Status   Status
+	// Duration is the time until the resource was ready, deleted or failed, or until the wait ended while it was pending
+	Duration time.Duration
+	// Message is the reason of a failure or the last observed progress of a pending resource
+	Message string
+	// Progress is the last observed progress before the resource was ready or deleted, or when the wait ended
+	Progress Progress
+	// Diagnostics are collected for a resource which failed or was pending when the wait ended
+	Diagnostics *Diagnostics
+}
+
+// Progress is the last observed state of a resource which is not yet ready or deleted
+type Progress struct {
+	// Replicas are the counts of pods of a workload, or nil for other resources
+	Replicas *Replicas
+	Message  string
+}
+
+// Replicas are the counts of ready, desired and updated pods of a workload.
+// For a job, ready are its succeeded pods and desired its completions.
+type Replicas struct {
+	Ready   int32
+	Desired int32
+	Updated int32
+}
+
+func (p Progress) String() string {
+	if p.Replicas == nil {
+		return p.Message
+	}
+	counts := fmt.Sprintf("%d/%d ready, %d updated", p.Replicas.Ready, p.Replicas.Desired, p.Replicas.Updated)
+	if p.Message == "" {
+		return counts
+	}
+	return counts + ", " + p.Message
+}
@@ -2,31 +2,56 @@ package kube
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/dieler/helm-wait/pkg/manifest"
 	"io"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
-	"path/filepath"
+	appslisters "k8s.io/client-go/listers/apps/v1"
 	"sort"
+	"strings"
 	"time"
 )
 
-var Config = filepath.Join(homedir.HomeDir(), ".kube", "config")
+const (
+	hookAnnotation             = "helm.sh/hook"
+	hookDeletePolicyAnnotation = "helm.sh/hook-delete-policy"
+	hookSucceededPolicy        = "hook-succeeded"
+)
 
 type Client struct {
-	clientset *kubernetes.Clientset
-	out       io.Writer
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	mapper        meta.RESTMapper
+	out           io.Writer
+	options       WaitOptions
+}
+
+// WaitOptions tune the conditions under which waiting for resources succeeds or fails
+type WaitOptions struct {
+	// MaxRestarts is the number of container restarts tolerated before a crash looping pod aborts the wait
+	MaxRestarts int32
+	// FailOnPaused aborts the wait for a paused deployment instead of skipping it
+	FailOnPaused bool
+	// IgnoredFinalizers are the finalizers which do not block a deletion, i.e. a resource being deleted
+	// which is only blocked by some of these counts as deleted
+	IgnoredFinalizers []string
 }
 
-func New(out io.Writer) (*Client, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", Config)
+// New creates a client from the given REST client getter, so that the same kube config,
+// context and Helm environment settings are used as for accessing the release history
+func New(getter genericclioptions.RESTClientGetter, out io.Writer, options WaitOptions) (*Client, error) {
+	config, err := getter.ToRESTConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -34,63 +59,137 @@ func New(out io.Writer) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Client{clientset: clientset, out: out}, nil
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := getter.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{clientset: clientset, dynamicClient: dynamicClient, mapper: mapper, out: out, options: options}, nil
 }
 
-// deployment holds associated replicaSet for a deployment
+// deployment holds associated new and old replicaSets for a deployment
 type deployment struct {
-	replicaSet *appsv1.ReplicaSet
-	deployment *appsv1.Deployment
-}
-
-// WaitForResources polls to get the current status of all deployments and stateful sets
-// until they are ready or a timeout is reached
-func (c *Client) WaitForResources(timeout time.Duration, resources []*manifest.MappingResult) error {
-	return wait.Poll(5*time.Second, timeout, func() (bool, error) {
-		statefulSets := []appsv1.StatefulSet{}
-		deployments := []deployment{}
-		for _, r := range resources {
-			switch r.Metadata.Kind {
-			case "ConfigMap":
-			case "Service":
-			case "ReplicationController":
-			case "Pod":
-			case "Deployment":
-				currentDeployment, err := c.clientset.AppsV1().Deployments(r.Metadata.ObjectMeta.Namespace).Get(context.TODO(), r.Metadata.ObjectMeta.Name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				// Find RS associated with deployment
-				newReplicaSet, err := c.getNewReplicaSet(currentDeployment)
-				if err != nil || newReplicaSet == nil {
-					return false, err
-				}
-				newDeployment := deployment{
-					newReplicaSet,
-					currentDeployment,
-				}
-				deployments = append(deployments, newDeployment)
-			case "StatefulSet":
-				sf, err := c.clientset.AppsV1().StatefulSets(r.Metadata.ObjectMeta.Namespace).Get(context.TODO(), r.Metadata.ObjectMeta.Name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
+	replicaSet     *appsv1.ReplicaSet
+	oldReplicaSets []*appsv1.ReplicaSet
+	deployment     *appsv1.Deployment
+}
+
+// WaitForResources watches the current status of all deployments, stateful sets, daemon sets, jobs
+// and custom resources by their status conditions until they are ready or a timeout is reached. A failed job, a stalled custom resource
+// or a pod of a new revision in an unrecoverable state aborts the wait immediately.
+// The results of all resources are returned even if the wait failed, with diagnostics of the resources which are not ready.
+// If the given context is canceled, its error is returned and no diagnostics are collected.
+func (c *Client) WaitForResources(ctx context.Context, timeout time.Duration, resources []*manifest.MappingResult) ([]Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	w, err := newWatcher(c, resources)
+	if err != nil {
+		return nil, err
+	}
+	err = w.wait(ctx, c.resourceReady(w), c.resourceProgress(w))
+	results := w.Results()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		c.diagnose(results)
+	}
+	return results, err
+}
+
+// resourceReady returns a readiness check which looks up the current state of a resource in the watch caches
+func (c *Client) resourceReady(w *watcher) readyFunc {
+	return func(r *manifest.MappingResult) (bool, error) {
+		namespace, name := r.Metadata.ObjectMeta.Namespace, r.Metadata.ObjectMeta.Name
+		if isDynamicResource(r) {
+			obj, err := w.getDynamic(r)
+			if err != nil {
+				return w.notFound(r, err)
+			}
+			return customResourceReady(obj)
+		}
+		factory := w.factory(namespace)
+		switch r.Metadata.Kind {
+		case "Deployment":
+			currentDeployment, err := factory.Apps().V1().Deployments().Lister().Deployments(namespace).Get(name)
+			if err != nil {
+				return w.notFound(r, err)
+			}
+			if err := deploymentFailed(currentDeployment); err != nil {
+				return false, err
+			}
+			if currentDeployment.Spec.Paused {
+				if c.options.FailOnPaused {
+					return false, failedf("deployment is paused: %s/%s", namespace, name)
 				}
-				statefulSets = append(statefulSets, *sf)
+				// The rollout will never progress, so do not wait for it
+				w.notice(r, "Deployment is paused, skipping: %s/%s\n", namespace, name)
+				return true, nil
+			}
+			// Find RS associated with deployment
+			newReplicaSet, oldReplicaSets, err := getReplicaSets(currentDeployment, rsListFromLister(factory.Apps().V1().ReplicaSets().Lister()))
+			if err != nil || newReplicaSet == nil {
+				return false, err
+			}
+			pods, err := listOwnedPods(factory.Core().V1().Pods().Lister(), newReplicaSet, newReplicaSet.Spec.Selector, nil)
+			if err != nil {
+				return false, err
+			}
+			if err := c.checkPods(pods); err != nil {
+				return false, err
+			}
+			return deploymentReady(deployment{newReplicaSet, oldReplicaSets, currentDeployment}), nil
+		case "StatefulSet":
+			sf, err := factory.Apps().V1().StatefulSets().Lister().StatefulSets(namespace).Get(name)
+			if err != nil {
+				return w.notFound(r, err)
+			}
+			revision := map[string]string{appsv1.ControllerRevisionHashLabelKey: sf.Status.UpdateRevision}
+			pods, err := listOwnedPods(factory.Core().V1().Pods().Lister(), sf, sf.Spec.Selector, revision)
+			if err != nil {
+				return false, err
+			}
+			if err := c.checkPods(pods); err != nil {
+				return false, err
 			}
+			return statefulSetReady(sf), nil
+		case "DaemonSet":
+			ds, err := factory.Apps().V1().DaemonSets().Lister().DaemonSets(namespace).Get(name)
+			if err != nil {
+				return w.notFound(r, err)
+			}
+			return daemonSetReady(ds), nil
+		case "Job":
+			job, err := factory.Batch().V1().Jobs().Lister().Jobs(namespace).Get(name)
+			if apierrors.IsNotFound(err) {
+				// The cache has synced, so the job has been deleted, e.g. by its TTL after it finished
+				w.notice(r, "Job not found, assuming it completed and was deleted: %s/%s\n", namespace, name)
+				return true, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return jobReady(job)
 		}
-		isReady := c.statefulSetsReady(statefulSets) && c.deploymentsReady(deployments)
-		return isReady, nil
-	})
+		return true, nil
+	}
 }
 
-// GetNewReplicaSet returns a replica set that matches the intent of the given deployment; get ReplicaSetList from client interface.
-// Returns nil if the new replica set doesn't exist yet.
-func (c *Client) getNewReplicaSet(deployment *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
-	rsList, err := c.listReplicaSets(deployment, c.rsListFromClient())
+// GetReplicaSets returns the replica set that matches the intent of the given deployment and the old replica sets;
+// get ReplicaSetList from the given function. Returns nil as new replica set if it doesn't exist yet.
+func getReplicaSets(deployment *appsv1.Deployment, getRSList RsListFunc) (*appsv1.ReplicaSet, []*appsv1.ReplicaSet, error) {
+	rsList, err := listReplicaSets(deployment, getRSList)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return findNewReplicaSet(deployment, rsList), nil
+	newReplicaSet := findNewReplicaSet(deployment, rsList)
+	var oldReplicaSets []*appsv1.ReplicaSet
+	for _, rs := range rsList {
+		if rs != newReplicaSet {
+			oldReplicaSets = append(oldReplicaSets, rs)
+		}
+	}
+	return newReplicaSet, oldReplicaSets, nil
 }
 
 // RsListFunc returns the ReplicaSet from the ReplicaSet namespace and the List metav1.ListOptions.
@@ -100,7 +199,7 @@ type RsListFunc func(string, metav1.ListOptions) ([]*appsv1.ReplicaSet, error)
 // Note that this does NOT attempt to reconcile ControllerRef (adopt/orphan),
 // because only the controller itself should do that.
 // However, it does filter out anything whose ControllerRef doesn't match.
-func (c *Client) listReplicaSets(deployment *appsv1.Deployment, getRSList RsListFunc) ([]*appsv1.ReplicaSet, error) {
+func listReplicaSets(deployment *appsv1.Deployment, getRSList RsListFunc) ([]*appsv1.ReplicaSet, error) {
 	// TODO: Right now we list replica sets by their labels. We should list them by selector, i.e. the replica set's selector
 	//       should be a superset of the deployment's selector, see https://github.com/kubernetes/kubernetes/issues/19830.
 	namespace := deployment.Namespace
@@ -123,19 +222,47 @@ func (c *Client) listReplicaSets(deployment *appsv1.Deployment, getRSList RsList
 	return owned, nil
 }
 
-// RsListFromClient returns an rsListFunc that wraps the given client.
-func (c *Client) rsListFromClient() RsListFunc {
+// RsListFromLister returns an rsListFunc that wraps the given lister.
+func rsListFromLister(lister appslisters.ReplicaSetLister) RsListFunc {
 	return func(namespace string, options metav1.ListOptions) ([]*appsv1.ReplicaSet, error) {
-		rsList, err := c.clientset.AppsV1().ReplicaSets(namespace).List(context.TODO(), options)
+		selector, err := labels.Parse(options.LabelSelector)
 		if err != nil {
 			return nil, err
 		}
-		var ret []*appsv1.ReplicaSet
-		for i := range rsList.Items {
-			ret = append(ret, &rsList.Items[i])
+		return lister.ReplicaSets(namespace).List(selector)
+	}
+}
+
+// notFound returns true for a hook which Helm deletes once it succeeded, as it cannot be found anymore after that.
+// Otherwise a not found error is ignored, so that the resource is not ready.
+func (w *watcher) notFound(r *manifest.MappingResult, err error) (bool, error) {
+	if apierrors.IsNotFound(err) && deletedOnSuccess(r) {
+		w.notice(r, "%s not found, assuming the hook succeeded and was deleted: %s/%s\n", r.Metadata.Kind, r.Metadata.ObjectMeta.Namespace, r.Metadata.ObjectMeta.Name)
+		return true, nil
+	}
+	return false, ignoreNotFound(err)
+}
+
+// deletedOnSuccess returns true if the resource is a hook with a delete policy of deleting it once it succeeded
+func deletedOnSuccess(r *manifest.MappingResult) bool {
+	annotations := r.Metadata.ObjectMeta.Annotations
+	if annotations[hookAnnotation] == "" {
+		return false
+	}
+	for _, policy := range strings.Split(annotations[hookDeletePolicyAnnotation], ",") {
+		if strings.TrimSpace(policy) == hookSucceededPolicy {
+			return true
 		}
-		return ret, err
 	}
+	return false
+}
+
+// ignoreNotFound returns nil for a not found error, as a resource may not yet be in the watch cache
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
 // EqualIgnoreHash returns true if two given podTemplateSpec are equal, ignoring the diff in value of Labels[pod-template-hash]
@@ -180,22 +307,118 @@ func findNewReplicaSet(deployment *appsv1.Deployment, rsList []*appsv1.ReplicaSe
 	return nil
 }
 
-func (c *Client) statefulSetsReady(statefulsets []appsv1.StatefulSet) bool {
-	for _, sf := range statefulsets {
-		if sf.Status.UpdateRevision != sf.Status.CurrentRevision || sf.Status.ReadyReplicas != *sf.Spec.Replicas {
-			fmt.Fprintf(c.out, "StatefulSet is not ready: %s/%s\n", sf.GetNamespace(), sf.GetName())
-			return false
+// statefulSetReady returns true if the controller has observed the current spec, all replicas are ready
+// and available, and as many replicas are updated as the update strategy demands: with a partition only
+// the replicas with an ordinal of at least the partition are updated, with OnDelete pods are only replaced
+// when deleted manually, hence updated pods are not required then.
+func statefulSetReady(sf *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if sf.Spec.Replicas != nil {
+		replicas = *sf.Spec.Replicas
+	}
+	status := sf.Status
+	if status.ObservedGeneration < sf.Generation || status.ReadyReplicas != replicas {
+		return false
+	}
+	// Ready replicas become available only after MinReadySeconds, so available replicas are only checked if it is set
+	if sf.Spec.MinReadySeconds > 0 && status.AvailableReplicas != replicas {
+		return false
+	}
+	if sf.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return true
+	}
+	var partition int32
+	if rollingUpdate := sf.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil {
+		partition = *rollingUpdate.Partition
+	}
+	if partition == 0 {
+		return status.UpdateRevision == status.CurrentRevision && status.UpdatedReplicas == replicas
+	}
+	expectedUpdated := replicas - partition
+	if expectedUpdated < 0 {
+		expectedUpdated = 0
+	}
+	return status.UpdatedReplicas >= expectedUpdated
+}
+
+// deploymentFailed returns an error if the deployment controller reports that the rollout exceeded its progress deadline.
+// Like kubectl rollout status, the conditions are only checked once the controller has observed the current spec,
+// as a condition of a previous rollout is kept until then.
+func deploymentFailed(d *appsv1.Deployment) error {
+	if d.Status.ObservedGeneration < d.Generation {
+		return nil
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Status == v1.ConditionFalse && c.Reason == "ProgressDeadlineExceeded" {
+			return failedf("deployment exceeded its progress deadline: %s/%s: %s", d.Namespace, d.Name, c.Message)
 		}
 	}
-	return true
+	return nil
 }
 
-func (c *Client) deploymentsReady(deployments []deployment) bool {
-	for _, d := range deployments {
-		if d.replicaSet.Status.ReadyReplicas != *d.deployment.Spec.Replicas {
-			fmt.Fprintf(c.out, "Deployment is not ready: %s/%s\n", d.deployment.GetNamespace(), d.deployment.GetName())
+// deploymentReady returns true if the controller has observed the current spec, all replicas are updated,
+// available and ready, and all pods of old replica sets have been scaled down
+func deploymentReady(d deployment) bool {
+	replicas := int32(1)
+	if d.deployment.Spec.Replicas != nil {
+		replicas = *d.deployment.Spec.Replicas
+	}
+	status := d.deployment.Status
+	if status.ObservedGeneration < d.deployment.Generation ||
+		status.UpdatedReplicas != replicas ||
+		status.AvailableReplicas != replicas ||
+		d.replicaSet.Status.ReadyReplicas != replicas {
+		return false
+	}
+	for _, rs := range d.oldReplicaSets {
+		if rs.Status.Replicas > 0 {
 			return false
 		}
 	}
 	return true
 }
+
+// daemonSetReady returns true if the controller has observed the current spec and all scheduled pods
+// are updated and available. With the OnDelete strategy pods are only replaced when deleted manually,
+// hence updated pods are not required then.
+func daemonSetReady(ds *appsv1.DaemonSet) bool {
+	if ds.Status.ObservedGeneration < ds.Generation {
+		return false
+	}
+	if ds.Spec.UpdateStrategy.Type != appsv1.OnDeleteDaemonSetStrategyType &&
+		ds.Status.UpdatedNumberScheduled != ds.Status.DesiredNumberScheduled {
+		return false
+	}
+	return ds.Status.NumberAvailable == ds.Status.DesiredNumberScheduled
+}
+
+// jobReady returns an error for a failed job, so that the wait is not continued
+// until the timeout for a job which will never complete
+func jobReady(job *batchv1.Job) (bool, error) {
+	if failed, reason := jobFailed(job); failed {
+		return false, failedf("job failed: %s/%s: %s", job.GetNamespace(), job.GetName(), reason)
+	}
+	return jobComplete(job), nil
+}
+
+func jobComplete(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobComplete && c.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// jobFailed returns true and the reason if the job has a Failed condition or has exceeded its backoff limit
+func jobFailed(job *batchv1.Job) (bool, string) {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == v1.ConditionTrue {
+			return true, fmt.Sprintf("%s: %s", c.Reason, c.Message)
+		}
+	}
+	if job.Spec.BackoffLimit != nil && job.Status.Failed > *job.Spec.BackoffLimit {
+		return true, fmt.Sprintf("BackoffLimitExceeded: %d failed pods exceed backoff limit %d", job.Status.Failed, *job.Spec.BackoffLimit)
+	}
+	return false, ""
+}
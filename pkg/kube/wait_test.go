@@ -0,0 +1,720 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"strings"
+	"testing"
+	"time"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func resource(kind, namespace, name string) *manifest.MappingResult {
+	metadata := manifest.Metadata{
+		Kind:       kind,
+		ObjectMeta: manifest.ObjectMeta{Namespace: namespace, Name: name},
+	}
+	return &manifest.MappingResult{Name: metadata.String(), Metadata: metadata}
+}
+
+func newDeployment(namespace, name string, replicas int32) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: "deployment-uid"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(replicas),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+		},
+	}
+}
+
+func newReplicaSet(d *appsv1.Deployment, name string, readyReplicas int32) *appsv1.ReplicaSet {
+	isController := true
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: d.Namespace,
+			Name:      name,
+			Labels:    d.Spec.Template.Labels,
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: d.Name, UID: d.UID, Controller: &isController},
+			},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: d.Spec.Replicas,
+			Selector: d.Spec.Selector,
+			Template: d.Spec.Template,
+		},
+		Status: appsv1.ReplicaSetStatus{Replicas: *d.Spec.Replicas, ReadyReplicas: readyReplicas},
+	}
+}
+
+func readyDeployment(d *appsv1.Deployment) *appsv1.Deployment {
+	ready := d.DeepCopy()
+	ready.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: d.Generation,
+		Replicas:           *d.Spec.Replicas,
+		UpdatedReplicas:    *d.Spec.Replicas,
+		ReadyReplicas:      *d.Spec.Replicas,
+		AvailableReplicas:  *d.Spec.Replicas,
+	}
+	return ready
+}
+
+// watchReactor returns the given watchers one after the other for each watch request,
+// so that tests control which events the informers receive
+func watchReactor(watchers ...*watch.FakeWatcher) k8stesting.WatchReactionFunc {
+	return func(action k8stesting.Action) (bool, watch.Interface, error) {
+		if len(watchers) == 0 {
+			return true, watch.NewFake(), nil
+		}
+		w := watchers[0]
+		watchers = watchers[1:]
+		return true, w, nil
+	}
+}
+
+func waitAsync(c *Client, timeout time.Duration, resources ...*manifest.MappingResult) chan error {
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.WaitForResources(context.Background(), timeout, resources)
+		result <- err
+	}()
+	return result
+}
+
+func TestWaitForDeploymentOnWatchEvent(t *testing.T) {
+	d := newDeployment("default", "nginx", 2)
+	rs := newReplicaSet(d, "nginx-1", 2)
+	clientset := fake.NewSimpleClientset(d, rs)
+	deploymentWatcher := watch.NewFake()
+	clientset.PrependWatchReactor("deployments", watchReactor(deploymentWatcher))
+	c := &Client{clientset: clientset, out: &bytes.Buffer{}}
+
+	result := waitAsync(c, 10*time.Second, resource("Deployment", "default", "nginx"))
+	deploymentWatcher.Modify(readyDeployment(d))
+
+	require.NoError(t, <-result)
+}
+
+func TestWaitRelistsOnWatchError(t *testing.T) {
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"},
+		Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 1},
+	}
+	clientset := fake.NewSimpleClientset(ds)
+	dsWatcher := watch.NewFake()
+	clientset.PrependWatchReactor("daemonsets", watchReactor(dsWatcher))
+	c := &Client{clientset: clientset, out: &bytes.Buffer{}}
+
+	result := waitAsync(c, 10*time.Second, resource("DaemonSet", "default", "agent"))
+	ready := ds.DeepCopy()
+	ready.Status.NumberAvailable = 3
+	gvr := appsv1.SchemeGroupVersion.WithResource("daemonsets")
+	require.NoError(t, clientset.Tracker().Update(gvr, ready, "default"))
+	// The update is only seen by relisting after the watch failed
+	dsWatcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired})
+
+	require.NoError(t, <-result)
+}
+
+func TestWaitFailsOnFailedJob(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "migrate"},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"},
+			},
+		},
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(job), out: &bytes.Buffer{}}
+
+	results, err := c.WaitForResources(context.Background(), 10*time.Second, []*manifest.MappingResult{resource("Job", "default", "migrate")})
+
+	require.EqualError(t, err, "job failed: default/migrate: BackoffLimitExceeded: Job has reached the specified backoff limit")
+	var failed *FailedError
+	require.ErrorAs(t, err, &failed)
+	require.Len(t, results, 1)
+	require.Equal(t, StatusFailed, results[0].Status)
+	require.Equal(t, err.Error(), results[0].Message)
+}
+
+func TestWaitForDeletedJob(t *testing.T) {
+	var out bytes.Buffer
+	c := &Client{clientset: fake.NewSimpleClientset(), out: &out}
+
+	results, err := c.WaitForResources(context.Background(), 10*time.Second, []*manifest.MappingResult{resource("Job", "default", "migrate")})
+
+	require.NoError(t, err)
+	require.Equal(t, StatusReady, results[0].Status)
+	require.Contains(t, out.String(), "Job not found, assuming it completed and was deleted: default/migrate\n")
+}
+
+func TestWaitForHookDeletedOnSuccess(t *testing.T) {
+	var out bytes.Buffer
+	c := &Client{clientset: fake.NewSimpleClientset(), out: &out}
+	hook := resource("Deployment", "default", "smoke-test")
+	hook.Metadata.ObjectMeta.Annotations = map[string]string{
+		"helm.sh/hook":               "post-install",
+		"helm.sh/hook-delete-policy": "before-hook-creation, hook-succeeded",
+	}
+
+	results, err := c.WaitForResources(context.Background(), 10*time.Second, []*manifest.MappingResult{hook})
+
+	require.NoError(t, err)
+	require.Equal(t, StatusReady, results[0].Status)
+	require.Contains(t, out.String(), "Deployment not found, assuming the hook succeeded and was deleted: default/smoke-test\n")
+}
+
+func TestDeletedOnSuccess(t *testing.T) {
+	var tests = []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{"NoHook", map[string]string{"helm.sh/hook-delete-policy": "hook-succeeded"}, false},
+		{"NoDeletePolicy", map[string]string{"helm.sh/hook": "post-install"}, false},
+		{"BeforeHookCreation", map[string]string{"helm.sh/hook": "post-install", "helm.sh/hook-delete-policy": "before-hook-creation"}, false},
+		{"HookSucceeded", map[string]string{"helm.sh/hook": "post-install", "helm.sh/hook-delete-policy": "hook-succeeded"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := resource("Job", "default", "migrate")
+			r.Metadata.ObjectMeta.Annotations = tt.annotations
+			require.Equal(t, tt.expected, deletedOnSuccess(r))
+		})
+	}
+}
+
+func TestWaitTimesOut(t *testing.T) {
+	sf := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(1)},
+	}
+	c := &Client{clientset: fake.NewSimpleClientset([]runtime.Object{sf}...), out: &bytes.Buffer{}}
+
+	// The timeout must exceed the interval in which informer caches are checked for being synced
+	results, err := c.WaitForResources(context.Background(), time.Second, []*manifest.MappingResult{resource("StatefulSet", "default", "db")})
+
+	require.ErrorIs(t, err, wait.ErrWaitTimeout)
+	require.Len(t, results, 1)
+	require.Equal(t, StatusPending, results[0].Status)
+	require.Equal(t, "0/1 ready, 0 updated", results[0].Message)
+	require.GreaterOrEqual(t, results[0].Duration, time.Second)
+}
+
+func TestWaitCanceled(t *testing.T) {
+	sf := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(1)},
+	}
+	c := &Client{clientset: fake.NewSimpleClientset([]runtime.Object{sf}...), out: &bytes.Buffer{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	results, err := c.WaitForResources(ctx, 10*time.Second, []*manifest.MappingResult{resource("StatefulSet", "default", "db")})
+
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, results, 1)
+	require.Equal(t, StatusPending, results[0].Status)
+	require.Nil(t, results[0].Diagnostics)
+}
+
+func TestCheckPod(t *testing.T) {
+	waiting := func(reason string, restarts int32) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx-1"},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "nginx", RestartCount: restarts, State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason, Message: "failing"}}},
+			}},
+		}
+	}
+	var tests = []struct {
+		name     string
+		pod      *v1.Pod
+		expected string
+	}{
+		{"ContainerCreating", waiting("ContainerCreating", 0), ""},
+		{"CrashLoopBackOffTolerated", waiting("CrashLoopBackOff", 2), ""},
+		{"CrashLoopBackOff", waiting("CrashLoopBackOff", 3), "pod default/nginx-1 container nginx: CrashLoopBackOff: failing (restarts: 3)"},
+		{"ImagePullBackOff", waiting("ImagePullBackOff", 0), "pod default/nginx-1 container nginx: ImagePullBackOff: failing (restarts: 0)"},
+		{"Unschedulable", &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx-1"},
+			Status: v1.PodStatus{Conditions: []v1.PodCondition{
+				{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable, Message: "0/3 nodes are available"},
+			}},
+		}, "pod default/nginx-1 is unschedulable: 0/3 nodes are available"},
+	}
+
+	c := &Client{options: WaitOptions{MaxRestarts: 2}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.checkPod(tt.pod)
+			if tt.expected == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWaitFailsOnProgressDeadlineExceeded(t *testing.T) {
+	d := newDeployment("default", "nginx", 1)
+	d.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Status: v1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: `ReplicaSet "nginx-1" has timed out progressing.`},
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(d, newReplicaSet(d, "nginx-1", 0)), out: &bytes.Buffer{}}
+
+	_, err := c.WaitForResources(context.Background(), 10*time.Second, []*manifest.MappingResult{resource("Deployment", "default", "nginx")})
+
+	require.EqualError(t, err, `deployment exceeded its progress deadline: default/nginx: ReplicaSet "nginx-1" has timed out progressing.`)
+}
+
+func TestDeploymentFailedIgnoresPreviousGeneration(t *testing.T) {
+	d := newDeployment("default", "nginx", 1)
+	d.Generation = 2
+	d.Status.ObservedGeneration = 1
+	d.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Status: v1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: `ReplicaSet "nginx-1" has timed out progressing.`},
+	}
+	// The condition belongs to the rollout of the previous generation
+	require.NoError(t, deploymentFailed(d))
+
+	d.Status.ObservedGeneration = 2
+	require.EqualError(t, deploymentFailed(d), `deployment exceeded its progress deadline: default/nginx: ReplicaSet "nginx-1" has timed out progressing.`)
+}
+
+func TestWaitForPausedDeployment(t *testing.T) {
+	d := newDeployment("default", "nginx", 1)
+	d.Spec.Paused = true
+	resources := []*manifest.MappingResult{resource("Deployment", "default", "nginx")}
+
+	var out bytes.Buffer
+	c := &Client{clientset: fake.NewSimpleClientset(d, newReplicaSet(d, "nginx-1", 0)), out: &out}
+	_, err := c.WaitForResources(context.Background(), 10*time.Second, resources)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "Deployment is paused, skipping: default/nginx\n")
+
+	c = &Client{clientset: fake.NewSimpleClientset(d, newReplicaSet(d, "nginx-1", 0)), out: &bytes.Buffer{}, options: WaitOptions{FailOnPaused: true}}
+	_, err = c.WaitForResources(context.Background(), 10*time.Second, resources)
+	require.EqualError(t, err, "deployment is paused: default/nginx")
+}
+
+func TestFindNewReplicaSet(t *testing.T) {
+	d := newDeployment("default", "nginx", 1)
+	now := metav1.Now()
+	old := newReplicaSet(d, "nginx-old", 0)
+	old.Spec.Template.Spec.Containers = []v1.Container{{Name: "nginx", Image: "nginx:1.24"}}
+	newer := newReplicaSet(d, "nginx-newer", 1)
+	newer.CreationTimestamp = metav1.NewTime(now.Add(time.Minute))
+	oldest := newReplicaSet(d, "nginx-oldest", 1)
+	oldest.CreationTimestamp = now
+	hashed := newReplicaSet(d, "nginx-hashed", 1)
+	hashed.CreationTimestamp = metav1.NewTime(now.Add(-time.Minute))
+	hashed.Spec.Template.Labels = map[string]string{"app": "nginx", appsv1.DefaultDeploymentUniqueLabelKey: "12345"}
+
+	require.Nil(t, findNewReplicaSet(d, []*appsv1.ReplicaSet{old}))
+	require.Equal(t, oldest, findNewReplicaSet(d, []*appsv1.ReplicaSet{old, newer, oldest}))
+	require.Equal(t, hashed, findNewReplicaSet(d, []*appsv1.ReplicaSet{old, newer, oldest, hashed}))
+}
+
+func TestDeploymentReady(t *testing.T) {
+	d := newDeployment("default", "nginx", 2)
+	d.Generation = 2
+	rs := newReplicaSet(d, "nginx-2", 2)
+	oldRS := newReplicaSet(d, "nginx-1", 0)
+	oldRS.Status.Replicas = 0
+
+	var tests = []struct {
+		name     string
+		modify   func(d *deployment)
+		expected bool
+	}{
+		{"Ready", func(d *deployment) {}, true},
+		{"GenerationNotObserved", func(d *deployment) { d.deployment.Status.ObservedGeneration = 1 }, false},
+		{"NotUpdated", func(d *deployment) { d.deployment.Status.UpdatedReplicas = 1 }, false},
+		{"NotAvailable", func(d *deployment) { d.deployment.Status.AvailableReplicas = 1 }, false},
+		{"NewReplicaSetNotReady", func(d *deployment) { d.replicaSet.Status.ReadyReplicas = 1 }, false},
+		{"OldPodsRunning", func(d *deployment) { d.oldReplicaSets[0].Status.Replicas = 1 }, false},
+		{"DefaultReplicas", func(d *deployment) {
+			d.deployment.Spec.Replicas = nil
+			d.deployment.Status.UpdatedReplicas = 1
+			d.deployment.Status.AvailableReplicas = 1
+			d.replicaSet.Status.ReadyReplicas = 1
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep := deployment{rs.DeepCopy(), []*appsv1.ReplicaSet{oldRS.DeepCopy()}, readyDeployment(d)}
+			tt.modify(&dep)
+			require.Equal(t, tt.expected, deploymentReady(dep))
+		})
+	}
+}
+
+func TestStatefulSetReady(t *testing.T) {
+	ready := func() *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db", Generation: 2},
+			Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3)},
+			Status: appsv1.StatefulSetStatus{
+				ObservedGeneration: 2,
+				Replicas:           3,
+				ReadyReplicas:      3,
+				AvailableReplicas:  3,
+				UpdatedReplicas:    3,
+				CurrentRevision:    "db-2",
+				UpdateRevision:     "db-2",
+			},
+		}
+	}
+	partitioned := func(partition int32) func(sf *appsv1.StatefulSet) {
+		return func(sf *appsv1.StatefulSet) {
+			sf.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: int32Ptr(partition)}
+			sf.Status.CurrentRevision = "db-1"
+			sf.Status.UpdatedReplicas = 1
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		modify   func(sf *appsv1.StatefulSet)
+		expected bool
+	}{
+		{"Ready", func(sf *appsv1.StatefulSet) {}, true},
+		{"GenerationNotObserved", func(sf *appsv1.StatefulSet) { sf.Status.ObservedGeneration = 1 }, false},
+		{"NotReady", func(sf *appsv1.StatefulSet) { sf.Status.ReadyReplicas = 2 }, false},
+		{"NotUpdated", func(sf *appsv1.StatefulSet) { sf.Status.CurrentRevision = "db-1" }, false},
+		{"NotAvailable", func(sf *appsv1.StatefulSet) {
+			sf.Spec.MinReadySeconds = 10
+			sf.Status.AvailableReplicas = 2
+		}, false},
+		{"DefaultReplicas", func(sf *appsv1.StatefulSet) {
+			sf.Spec.Replicas = nil
+			sf.Status.ReadyReplicas = 1
+			sf.Status.UpdatedReplicas = 1
+		}, true},
+		{"PartitionUpdated", partitioned(2), true},
+		{"PartitionNotUpdated", partitioned(1), false},
+		{"PartitionExceedsReplicas", func(sf *appsv1.StatefulSet) {
+			partitioned(5)(sf)
+			sf.Status.UpdatedReplicas = 0
+		}, true},
+		{"OnDelete", func(sf *appsv1.StatefulSet) {
+			sf.Spec.UpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+			sf.Status.CurrentRevision = "db-1"
+			sf.Status.UpdatedReplicas = 0
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sf := ready()
+			tt.modify(sf)
+			require.Equal(t, tt.expected, statefulSetReady(sf))
+		})
+	}
+}
+
+func TestDaemonSetReady(t *testing.T) {
+	ready := func() *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent", Generation: 2},
+			Status: appsv1.DaemonSetStatus{
+				ObservedGeneration:     2,
+				DesiredNumberScheduled: 3,
+				UpdatedNumberScheduled: 3,
+				NumberAvailable:        3,
+			},
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		modify   func(ds *appsv1.DaemonSet)
+		expected bool
+	}{
+		{"Ready", func(ds *appsv1.DaemonSet) {}, true},
+		{"GenerationNotObserved", func(ds *appsv1.DaemonSet) { ds.Status.ObservedGeneration = 1 }, false},
+		{"NotUpdated", func(ds *appsv1.DaemonSet) { ds.Status.UpdatedNumberScheduled = 2 }, false},
+		{"NotAvailable", func(ds *appsv1.DaemonSet) { ds.Status.NumberAvailable = 2 }, false},
+		{"OnDeleteNotUpdated", func(ds *appsv1.DaemonSet) {
+			ds.Spec.UpdateStrategy.Type = appsv1.OnDeleteDaemonSetStrategyType
+			ds.Status.UpdatedNumberScheduled = 0
+		}, true},
+		{"OnDeleteNotAvailable", func(ds *appsv1.DaemonSet) {
+			ds.Spec.UpdateStrategy.Type = appsv1.OnDeleteDaemonSetStrategyType
+			ds.Status.NumberAvailable = 2
+		}, false},
+		{"NoNodes", func(ds *appsv1.DaemonSet) {
+			ds.Status.DesiredNumberScheduled = 0
+			ds.Status.UpdatedNumberScheduled = 0
+			ds.Status.NumberAvailable = 0
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := ready()
+			tt.modify(ds)
+			require.Equal(t, tt.expected, daemonSetReady(ds))
+		})
+	}
+}
+
+func newCertificate(conditions ...interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata":   map[string]interface{}{"namespace": "default", "name": "tls", "generation": int64(2)},
+		"status":     map[string]interface{}{"observedGeneration": int64(2), "conditions": conditions},
+	}}
+}
+
+func condition(conditionType, status string) map[string]interface{} {
+	return map[string]interface{}{"type": conditionType, "status": status, "reason": "Testing", "message": "testing"}
+}
+
+func TestCustomResourceReady(t *testing.T) {
+	var tests = []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		expected bool
+		err      string
+	}{
+		{"NoConditions", newCertificate(), true, ""},
+		{"Ready", newCertificate(condition("Ready", "True")), true, ""},
+		{"NotReady", newCertificate(condition("Ready", "False")), false, ""},
+		{"Available", newCertificate(condition("Available", "True")), true, ""},
+		{"Reconciling", newCertificate(condition("Ready", "True"), condition("Reconciling", "True")), false, ""},
+		{"Stalled", newCertificate(condition("Stalled", "True")), false, "Certificate is stalled: default/tls: Testing: testing"},
+		{"GenerationNotObserved", func() *unstructured.Unstructured {
+			obj := newCertificate(condition("Ready", "True"))
+			obj.SetGeneration(3)
+			return obj
+		}(), false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, err := customResourceReady(tt.obj)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+			require.Equal(t, tt.expected, ready)
+		})
+	}
+}
+
+func TestWaitForCustomResource(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+	gvr := gvk.GroupVersion().WithResource("certificates")
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "CertificateList"}, newCertificate(condition("Ready", "False")))
+	certificateWatcher := watch.NewFake()
+	dynamicClient.PrependWatchReactor("certificates", watchReactor(certificateWatcher))
+	c := &Client{clientset: fake.NewSimpleClientset(), dynamicClient: dynamicClient, mapper: mapper, out: &bytes.Buffer{}}
+
+	certificate := resource("Certificate", "default", "tls")
+	certificate.Metadata.APIVersion = "cert-manager.io/v1"
+	result := waitAsync(c, 10*time.Second, certificate)
+	certificateWatcher.Modify(newCertificate(condition("Ready", "True")))
+
+	require.NoError(t, <-result)
+}
+
+func TestWaitForCustomResourceOfKubernetesGroup(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+	gvr := gvk.GroupVersion().WithResource("gateways")
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.AddSpecific(gvk, gvr, gvk.GroupVersion().WithResource("gateway"), meta.RESTScopeNamespace)
+	gateway := func(status string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1",
+			"kind":       "Gateway",
+			"metadata":   map[string]interface{}{"namespace": "default", "name": "web"},
+			"status":     map[string]interface{}{"conditions": []interface{}{condition("Ready", status)}},
+		}}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "GatewayList"}, gateway("False"))
+	gatewayWatcher := watch.NewFake()
+	dynamicClient.PrependWatchReactor("gateways", watchReactor(gatewayWatcher))
+	c := &Client{clientset: fake.NewSimpleClientset(), dynamicClient: dynamicClient, mapper: mapper, out: &bytes.Buffer{}}
+
+	r := resource("Gateway", "default", "web")
+	r.Metadata.APIVersion = "gateway.networking.k8s.io/v1"
+	result := waitAsync(c, 10*time.Second, r)
+	select {
+	case err := <-result:
+		t.Fatalf("wait returned before the gateway was ready: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+	gatewayWatcher.Modify(gateway("True"))
+	require.NoError(t, <-result)
+	// Only the gateway itself is listed, not all gateways in the namespace
+	list := dynamicClient.Actions()[0].(k8stesting.ListAction)
+	require.Equal(t, "metadata.name=web", list.GetListRestrictions().Fields.String())
+}
+
+func TestIsDynamicResource(t *testing.T) {
+	var tests = []struct {
+		apiVersion string
+		kind       string
+		expected   bool
+	}{
+		{"v1", "ConfigMap", false},
+		{"v1", "Pod", false},
+		{"rbac.authorization.k8s.io/v1", "ClusterRole", false},
+		{"apiextensions.k8s.io/v1", "CustomResourceDefinition", false},
+		{"apps/v1", "Deployment", false},
+		{"cert-manager.io/v1", "Certificate", true},
+		{"gateway.networking.k8s.io/v1", "Gateway", true},
+		{"snapshot.storage.k8s.io/v1", "VolumeSnapshot", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			r := resource(tt.kind, "default", "test")
+			r.Metadata.APIVersion = tt.apiVersion
+			require.Equal(t, tt.expected, isDynamicResource(r))
+		})
+	}
+}
+
+func TestWaitForDeletion(t *testing.T) {
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"}
+	gvr := gvk.GroupVersion().WithResource("persistentvolumeclaims")
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+	deletionTimestamp := metav1.Now()
+	pvc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata": map[string]interface{}{
+			"namespace":         "default",
+			"name":              "data",
+			"deletionTimestamp": deletionTimestamp.UTC().Format(time.RFC3339),
+			"finalizers":        []interface{}{"kubernetes.io/pvc-protection"},
+		},
+	}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "PersistentVolumeClaimList"}, pvc)
+	pvcWatcher := watch.NewFake()
+	dynamicClient.PrependWatchReactor("persistentvolumeclaims", watchReactor(pvcWatcher))
+	c := &Client{dynamicClient: dynamicClient, mapper: mapper, out: &bytes.Buffer{}}
+
+	claim := resource("PersistentVolumeClaim", "default", "data")
+	claim.Metadata.APIVersion = "v1"
+	// Kinds unknown to the cluster cannot exist anymore
+	unknown := resource("Certificate", "default", "tls")
+	unknown.Metadata.APIVersion = "cert-manager.io/v1"
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.WaitForDeletion(context.Background(), 10*time.Second, []*manifest.MappingResult{claim, unknown})
+		result <- err
+	}()
+	pvcWatcher.Delete(pvc)
+
+	require.NoError(t, <-result)
+}
+
+func TestBlockingFinalizers(t *testing.T) {
+	c := &Client{options: WaitOptions{IgnoredFinalizers: []string{"kubernetes.io/pvc-protection"}}}
+
+	require.Empty(t, c.blockingFinalizers([]string{"kubernetes.io/pvc-protection"}))
+	require.Equal(t, []string{"example.com/cleanup"}, c.blockingFinalizers([]string{"kubernetes.io/pvc-protection", "example.com/cleanup"}))
+}
+
+func TestTableRenderer(t *testing.T) {
+	web, db := resource("Deployment", "default", "web"), resource("StatefulSet", "default", "db")
+	w := &watcher{
+		resources: []*manifest.MappingResult{web, db},
+		results: map[string]*Result{
+			web.Name: {Resource: web, Status: StatusReady, Duration: 3 * time.Second, Progress: Progress{Replicas: &Replicas{Ready: 2, Desired: 2, Updated: 2}}},
+			db.Name:  {Resource: db, Status: StatusPending, Progress: Progress{Replicas: &Replicas{Ready: 0, Desired: 1, Updated: 1}}},
+		},
+		start: time.Now(),
+	}
+	var out bytes.Buffer
+	r := &tableRenderer{out: &out, width: 61}
+
+	r.refresh(w)
+	require.Equal(t, ""+
+		"KIND         NAMESPACE  NAME  READY  UPDATED  ELAPSED  STATUS\n"+
+		"Deployment   default    web   2/2    2        3s       ready \n"+
+		"StatefulSet  default    db    0/1    1        0s       pendin\n", out.String())
+
+	out.Reset()
+	r.log("StatefulSet is blocked\n")
+	require.True(t, strings.HasPrefix(out.String(), "\x1b[3A\x1b[JStatefulSet is blocked\nKIND"))
+}
+
+func TestWaitCollectsDiagnostics(t *testing.T) {
+	d := newDeployment("default", "nginx", 1)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx-1", Labels: d.Spec.Selector.MatchLabels},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:                 "nginx",
+				RestartCount:         1,
+				State:                v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}},
+			}},
+		},
+	}
+	event := func(name, kind, eventType, reason string) *v1.Event {
+		return &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: name},
+			InvolvedObject: v1.ObjectReference{Kind: kind, Name: "nginx-1"},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        "failing",
+			Count:          2,
+		}
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(d, newReplicaSet(d, "nginx-1", 0), pod,
+		event("unhealthy", "Pod", v1.EventTypeWarning, "Unhealthy"),
+		event("started", "Pod", v1.EventTypeNormal, "Started"),
+		event("other", "ReplicaSet", v1.EventTypeWarning, "FailedCreate"),
+	), out: &bytes.Buffer{}}
+
+	results, err := c.WaitForResources(context.Background(), time.Second, []*manifest.MappingResult{resource("Deployment", "default", "nginx")})
+
+	require.ErrorIs(t, err, wait.ErrWaitTimeout)
+	require.Len(t, results, 1)
+	require.Equal(t, &Diagnostics{Pods: []PodDiagnostics{{
+		Name:   "nginx-1",
+		Phase:  "Running",
+		Events: []Event{{Reason: "Unhealthy", Message: "failing", Count: 2}},
+		Containers: []ContainerDiagnostics{{
+			Name:            "nginx",
+			RestartCount:    1,
+			State:           "Running",
+			LastTermination: "Terminated: Error: exit code 1",
+			Logs:            "fake logs",
+		}},
+	}}}, results[0].Diagnostics)
+}
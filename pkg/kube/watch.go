@@ -0,0 +1,327 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dieler/helm-wait/pkg/manifest"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+	"time"
+)
+
+// readyFunc returns true if the given resource is ready, or an error if it will never become ready
+type readyFunc func(r *manifest.MappingResult) (bool, error)
+
+// watcher keeps informer caches for all kinds of resources to be waited on, scoped to the namespaces of the resources.
+// The informers list and watch the resources and relist them on watch errors, so that status changes
+// are noticed immediately without polling the API server.
+// Custom resources and resources to be deleted are watched by dynamic informers, each of them scoped to a single object
+// by its name, so that neither all objects of their kind are listed nor permissions beyond them are needed.
+type watcher struct {
+	resources        []*manifest.MappingResult
+	factories        map[string]informers.SharedInformerFactory
+	dynamicInformers map[string]informers.GenericInformer
+	mappings         map[string]*meta.RESTMapping
+	informers        map[cache.SharedIndexInformer]bool
+	changed          chan struct{}
+	noticed          map[string]bool
+	results          map[string]*Result
+	done             Status
+	start            time.Time
+	renderer         renderer
+}
+
+func newWatcher(c *Client, resources []*manifest.MappingResult) (*watcher, error) {
+	w := &watcher{
+		resources:        resources,
+		factories:        make(map[string]informers.SharedInformerFactory),
+		dynamicInformers: make(map[string]informers.GenericInformer),
+		mappings:         make(map[string]*meta.RESTMapping),
+		informers:        make(map[cache.SharedIndexInformer]bool),
+		changed:          make(chan struct{}, 1),
+		noticed:          make(map[string]bool),
+		results:          make(map[string]*Result),
+		done:             StatusReady,
+		renderer:         newRenderer(c.out),
+	}
+	for _, r := range resources {
+		namespace := r.Metadata.ObjectMeta.Namespace
+		factory, ok := w.factories[namespace]
+		if !ok {
+			factory = informers.NewSharedInformerFactoryWithOptions(c.clientset, 0, informers.WithNamespace(namespace))
+			w.factories[namespace] = factory
+		}
+		if isDynamicResource(r) {
+			if err := w.registerDynamic(c, r); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch r.Metadata.Kind {
+		case "Deployment":
+			w.register(factory.Apps().V1().Deployments().Informer())
+			w.register(factory.Apps().V1().ReplicaSets().Informer())
+			w.register(factory.Core().V1().Pods().Informer())
+		case "StatefulSet":
+			w.register(factory.Apps().V1().StatefulSets().Informer())
+			w.register(factory.Core().V1().Pods().Informer())
+		case "DaemonSet":
+			w.register(factory.Apps().V1().DaemonSets().Informer())
+		case "Job":
+			w.register(factory.Batch().V1().Jobs().Informer())
+		}
+	}
+	return w, nil
+}
+
+// newDeletionWatcher returns a watcher with dynamic informers for all given resources of any kind.
+// Resources of kinds unknown to the cluster are not watched, as they cannot exist anymore.
+func newDeletionWatcher(c *Client, resources []*manifest.MappingResult) (*watcher, error) {
+	w := &watcher{
+		factories:        make(map[string]informers.SharedInformerFactory),
+		dynamicInformers: make(map[string]informers.GenericInformer),
+		mappings:         make(map[string]*meta.RESTMapping),
+		informers:        make(map[cache.SharedIndexInformer]bool),
+		changed:          make(chan struct{}, 1),
+		noticed:          make(map[string]bool),
+		results:          make(map[string]*Result),
+		done:             StatusDeleted,
+		renderer:         newRenderer(c.out),
+	}
+	for _, r := range resources {
+		if err := w.registerDynamic(c, r); err != nil && !meta.IsNoMatchError(err) {
+			return nil, err
+		}
+		w.resources = append(w.resources, r)
+	}
+	return w, nil
+}
+
+// registerDynamic resolves the REST mapping of the given resource and registers a dynamic informer which only watches it
+func (w *watcher) registerDynamic(c *Client, r *manifest.MappingResult) error {
+	gv, err := schema.ParseGroupVersion(r.Metadata.APIVersion)
+	if err != nil {
+		return err
+	}
+	mapping, err := c.mapper.RESTMapping(gv.WithKind(r.Metadata.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return fmt.Errorf("failed to resolve resource %s: %w", r.Name, err)
+	}
+	w.mappings[r.Name] = mapping
+	selector := fields.OneTermEqualSelector("metadata.name", r.Metadata.ObjectMeta.Name).String()
+	informer := dynamicinformer.NewFilteredDynamicInformer(c.dynamicClient, mapping.Resource, w.namespace(r), 0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, func(options *metav1.ListOptions) {
+			options.FieldSelector = selector
+		})
+	w.dynamicInformers[r.Name] = informer
+	w.register(informer.Informer())
+	return nil
+}
+
+// namespace returns the namespace of the given resource, which is empty for cluster scoped resources watched by dynamic informers
+func (w *watcher) namespace(r *manifest.MappingResult) string {
+	if mapping, ok := w.mappings[r.Name]; ok && mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return ""
+	}
+	return r.Metadata.ObjectMeta.Namespace
+}
+
+// register adds an event handler notifying the watcher about any change of the informer's resources.
+// Registering the same informer again is a no-op, as the factory returns the same informer.
+func (w *watcher) register(informer cache.SharedIndexInformer) {
+	if w.informers[informer] {
+		return
+	}
+	w.informers[informer] = true
+	notify := func() {
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+	_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { notify() },
+		UpdateFunc: func(oldObj, newObj interface{}) { notify() },
+		DeleteFunc: func(obj interface{}) { notify() },
+	})
+}
+
+// notice prints the given message only once for the given resource, as the resources are checked on every event
+func (w *watcher) notice(r *manifest.MappingResult, format string, args ...interface{}) {
+	if w.noticed[r.Name] {
+		return
+	}
+	w.noticed[r.Name] = true
+	w.renderer.log(fmt.Sprintf(format, args...))
+}
+
+// watched returns true if the given resource is watched by a dynamic informer
+func (w *watcher) watched(r *manifest.MappingResult) bool {
+	_, ok := w.mappings[r.Name]
+	return ok
+}
+
+// factory returns the informer factory for the given namespace
+func (w *watcher) factory(namespace string) informers.SharedInformerFactory {
+	return w.factories[namespace]
+}
+
+// getDynamic returns the given resource watched by a dynamic informer from the watch cache
+func (w *watcher) getDynamic(r *manifest.MappingResult) (*unstructured.Unstructured, error) {
+	namespace := w.namespace(r)
+	lister := w.dynamicInformers[r.Name].Lister()
+	var obj runtime.Object
+	var err error
+	if namespace == "" {
+		obj, err = lister.Get(r.Metadata.ObjectMeta.Name)
+	} else {
+		obj, err = lister.ByNamespace(namespace).Get(r.Metadata.ObjectMeta.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*unstructured.Unstructured), nil
+}
+
+// wait starts the informers and checks all resources whenever one of them has changed,
+// until all of them are ready, one of them failed or the context is done.
+// The progress of all resources is rendered after every check and periodically in between.
+func (w *watcher) wait(ctx context.Context, ready readyFunc, progress progressFunc) error {
+	w.start = time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	for _, factory := range w.factories {
+		factory.Start(ctx.Done())
+	}
+	var running sync.WaitGroup
+	for _, informer := range w.dynamicInformers {
+		running.Add(1)
+		go func(informer cache.SharedIndexInformer) {
+			defer running.Done()
+			informer.Run(ctx.Done())
+		}(informer.Informer())
+	}
+	defer func() {
+		// Stop the informers before waiting for their termination
+		cancel()
+		for _, factory := range w.factories {
+			factory.Shutdown()
+		}
+		running.Wait()
+	}()
+	for _, factory := range w.factories {
+		for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return fmt.Errorf("failed to sync cache for %v: %w", informerType, doneErr(ctx))
+			}
+		}
+	}
+	for name, informer := range w.dynamicInformers {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+			return fmt.Errorf("failed to sync cache for %s: %w", name, doneErr(ctx))
+		}
+	}
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		allReady, err := w.check(ready, progress)
+		w.renderer.refresh(w)
+		if err != nil || allReady {
+			return err
+		}
+	waiting:
+		for {
+			select {
+			case <-ctx.Done():
+				w.renderer.refresh(w)
+				return doneErr(ctx)
+			case <-w.changed:
+				break waiting
+			case <-ticker.C:
+				w.renderer.refresh(w)
+			}
+		}
+	}
+}
+
+// doneErr returns the error of a done context, which is a timeout if its deadline exceeded,
+// so that a cancellation can be told apart from a timeout
+func doneErr(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return wait.ErrWaitTimeout
+	}
+	return ctx.Err()
+}
+
+// check checks all resources once and returns true if all of them are ready, or the error of the first failed one
+func (w *watcher) check(ready readyFunc, progress progressFunc) (bool, error) {
+	allReady := true
+	for _, r := range w.resources {
+		isReady, err := ready(r)
+		if err != nil {
+			w.record(r, StatusFailed, err.Error(), Progress{})
+			return false, err
+		}
+		switch {
+		case !isReady:
+			p := progress(r)
+			w.record(r, StatusPending, p.String(), p)
+		case w.done == StatusReady:
+			w.record(r, w.done, "", progress(r))
+		default:
+			// Deleted resources have no progress
+			w.record(r, w.done, "", Progress{})
+		}
+		allReady = allReady && isReady
+	}
+	return allReady, nil
+}
+
+// record updates the result of the given resource and renders its transition if its status changed.
+// The duration is only updated on a transition.
+func (w *watcher) record(r *manifest.MappingResult, status Status, message string, progress Progress) {
+	result, ok := w.results[r.Name]
+	if ok && result.Status == status {
+		result.Message = message
+		result.Progress = progress
+		return
+	}
+	if !ok {
+		result = &Result{Resource: r}
+		w.results[r.Name] = result
+	}
+	result.Status = status
+	result.Message = message
+	result.Progress = progress
+	result.Duration = time.Since(w.start)
+	w.renderer.transition(w, *result)
+}
+
+// Results returns the results of all resources in the order they were given. Resources which are still pending
+// have been waited on for the whole time.
+func (w *watcher) Results() []Result {
+	results := make([]Result, 0, len(w.resources))
+	for _, r := range w.resources {
+		result, ok := w.results[r.Name]
+		if !ok || result.Status == StatusPending {
+			pending := Result{Resource: r, Status: StatusPending, Duration: time.Since(w.start)}
+			if ok {
+				pending.Message = result.Message
+				pending.Progress = result.Progress
+			}
+			results = append(results, pending)
+			continue
+		}
+		results = append(results, *result)
+	}
+	return results
+}
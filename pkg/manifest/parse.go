@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"fmt"
 	"helm.sh/helm/v3/pkg/release"
-	"log"
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
@@ -69,10 +68,30 @@ func splitSpec(token string) (string, string) {
 }
 
 // ParseRelease parses release objects into MappingResult
-func ParseRelease(release *release.Release, includeTests bool) map[string]*MappingResult {
-	manifest := release.Manifest
-	for _, hook := range release.Hooks {
-		if !includeTests && isTestHook(hook.Events) {
+func ParseRelease(rel *release.Release, includeTests bool) (map[string]*MappingResult, error) {
+	return parseRelease(rel, func(hook *release.Hook) bool {
+		return includeTests || !isTestHook(hook.Events)
+	})
+}
+
+// ParseReleaseWithHooks parses release objects into MappingResult, including only hooks triggered by one of the given events
+func ParseReleaseWithHooks(rel *release.Release, events ...release.HookEvent) (map[string]*MappingResult, error) {
+	return parseRelease(rel, func(hook *release.Hook) bool {
+		for _, event := range hook.Events {
+			for _, e := range events {
+				if event == e {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+func parseRelease(rel *release.Release, includeHook func(hook *release.Hook) bool) (map[string]*MappingResult, error) {
+	manifest := rel.Manifest
+	for _, hook := range rel.Hooks {
+		if !includeHook(hook) {
 			continue
 		}
 
@@ -80,11 +99,58 @@ func ParseRelease(release *release.Release, includeTests bool) map[string]*Mappi
 		manifest += fmt.Sprintf("# Source: %s\n", hook.Path)
 		manifest += hook.Manifest
 	}
-	return Parse(manifest, release.Namespace)
+	return Parse(manifest, rel.Namespace)
+}
+
+// ParseError is returned if a document of a manifest cannot be parsed
+type ParseError struct {
+	// Source is the path of the template the document was rendered from, taken from its "# Source:" comment
+	Source string
+	// Index is the index of the document in the manifest, starting at 0
+	Index int
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("failed to parse document %d: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("failed to parse document %d (%s): %v", e.Index, e.Source, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DuplicateError is returned if a manifest contains the same resource several times.
+// It is returned together with the parsed resources, so that it can be reported as a warning.
+type DuplicateError struct {
+	// Duplicates are the names of the duplicated resources and the sources of the ignored documents
+	Duplicates []Duplicate
+}
+
+// Duplicate is a document which was ignored, as a document with the same resource was found before
+type Duplicate struct {
+	Name   string
+	Source string
+	Index  int
+}
+
+func (e *DuplicateError) Error() string {
+	duplicates := make([]string, 0, len(e.Duplicates))
+	for _, d := range e.Duplicates {
+		if d.Source == "" {
+			duplicates = append(duplicates, fmt.Sprintf("%s in document %d", d.Name, d.Index))
+		} else {
+			duplicates = append(duplicates, fmt.Sprintf("%s in document %d (%s)", d.Name, d.Index, d.Source))
+		}
+	}
+	return fmt.Sprintf("found duplicate resources in manifest, only the first of each is used: %s", strings.Join(duplicates, "; "))
 }
 
-// Parse parses manifest strings into MappingResult
-func Parse(manifest string, defaultNamespace string, excludedHooks ...string) map[string]*MappingResult {
+// Parse parses manifest strings into MappingResult. A document which cannot be parsed fails with a ParseError.
+// If resources are found several times, the first of each is kept and a DuplicateError is returned along with the result.
+func Parse(manifest string, defaultNamespace string, excludedHooks ...string) (map[string]*MappingResult, error) {
 	// Ensure we have a newline in front of the yaml seperator
 	scanner := bufio.NewScanner(strings.NewReader("\n" + manifest))
 	scanner.Split(scanYamlSpecs)
@@ -94,8 +160,9 @@ func Parse(manifest string, defaultNamespace string, excludedHooks ...string) ma
 	scanner.Scan()
 
 	result := make(map[string]*MappingResult)
+	var duplicates []Duplicate
 
-	for scanner.Scan() {
+	for index := 0; scanner.Scan(); index++ {
 		content := strings.TrimSpace(scanner.Text())
 		if content == "" {
 			continue
@@ -103,29 +170,42 @@ func Parse(manifest string, defaultNamespace string, excludedHooks ...string) ma
 
 		parsed, err := parseContent(content, defaultNamespace, excludedHooks...)
 		if err != nil {
-			log.Fatalf("%v", err)
+			return nil, &ParseError{Source: source(content), Index: index, Err: err}
 		}
 
 		for _, p := range parsed {
 			name := p.Name
 
 			if _, ok := result[name]; ok {
-				log.Printf("Error: Found duplicate key %#v in manifest", name)
+				duplicates = append(duplicates, Duplicate{Name: name, Source: source(content), Index: index})
 			} else {
 				result[name] = p
 			}
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		log.Fatalf("Error reading input: %s", err)
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+	if len(duplicates) > 0 {
+		return result, &DuplicateError{Duplicates: duplicates}
+	}
+	return result, nil
+}
+
+// source returns the path of the template a document was rendered from, as Helm adds it as a comment
+func source(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if path, ok := strings.CutPrefix(strings.TrimSpace(line), "# Source: "); ok {
+			return path
+		}
 	}
-	return result
+	return ""
 }
 
 func parseContent(content string, defaultNamespace string, excludedHooks ...string) ([]*MappingResult, error) {
 	var parsedMetadata Metadata
 	if err := yaml.Unmarshal([]byte(content), &parsedMetadata); err != nil {
-		log.Fatalf("YAML unmarshal error: %s\nCan't unmarshal %s", err, content)
+		return nil, fmt.Errorf("YAML unmarshal error: %w", err)
 	}
 
 	// Skip content without any ObjectMeta. It is probably a template that
@@ -142,20 +222,20 @@ func parseContent(content string, defaultNamespace string, excludedHooks ...stri
 		var list ListV1
 
 		if err := yaml.Unmarshal([]byte(content), &list); err != nil {
-			log.Fatalf("YAML unmarshal error: %s\nCan't unmarshal %s", err, content)
+			return nil, fmt.Errorf("YAML unmarshal error: %w", err)
 		}
 
 		var result []*MappingResult
 
-		for _, item := range list.Items {
+		for i, item := range list.Items {
 			subcontent, err := yaml.Marshal(item)
 			if err != nil {
-				log.Printf("YAML marshal error: %s\nCan't marshal %v", err, item)
+				return nil, fmt.Errorf("YAML marshal error of list item %d: %w", i, err)
 			}
 
 			subs, err := parseContent(string(subcontent), defaultNamespace, excludedHooks...)
 			if err != nil {
-				return nil, fmt.Errorf("Parsing YAML list item: %v", err)
+				return nil, fmt.Errorf("parsing YAML list item %d: %w", i, err)
 			}
 
 			result = append(result, subs...)
@@ -2,6 +2,7 @@ package manifest_test
 
 import (
 	"github.com/dieler/helm-wait/pkg/manifest"
+	"helm.sh/helm/v3/pkg/release"
 	"io/ioutil"
 	"sort"
 	"testing"
@@ -22,48 +23,116 @@ func TestPod(t *testing.T) {
 	spec, err := ioutil.ReadFile("testdata/pod.yaml")
 	require.NoError(t, err)
 
-	require.Equal(t,
-		[]string{"default, nginx, Pod (v1)"},
-		foundObjects(manifest.Parse(string(spec), "default")),
-	)
+	result, err := manifest.Parse(string(spec), "default")
+	require.NoError(t, err)
+	require.Equal(t, []string{"default, nginx, Pod (v1)"}, foundObjects(result))
 }
 
 func TestPodNamespace(t *testing.T) {
 	spec, err := ioutil.ReadFile("testdata/pod_namespace.yaml")
 	require.NoError(t, err)
 
-	require.Equal(t,
-		[]string{"batcave, nginx, Pod (v1)"},
-		foundObjects(manifest.Parse(string(spec), "default")),
-	)
+	result, err := manifest.Parse(string(spec), "default")
+	require.NoError(t, err)
+	require.Equal(t, []string{"batcave, nginx, Pod (v1)"}, foundObjects(result))
 }
 
 func TestDeployV1(t *testing.T) {
 	spec, err := ioutil.ReadFile("testdata/deploy_v1.yaml")
 	require.NoError(t, err)
 
-	require.Equal(t,
-		[]string{"default, nginx, Deployment (apps)"},
-		foundObjects(manifest.Parse(string(spec), "default")),
-	)
+	result, err := manifest.Parse(string(spec), "default")
+	require.NoError(t, err)
+	require.Equal(t, []string{"default, nginx, Deployment (apps)"}, foundObjects(result))
 }
 
 func TestDeployV1Beta1(t *testing.T) {
 	spec, err := ioutil.ReadFile("testdata/deploy_v1beta1.yaml")
 	require.NoError(t, err)
 
-	require.Equal(t,
-		[]string{"default, nginx, Deployment (apps)"},
-		foundObjects(manifest.Parse(string(spec), "default")),
-	)
+	result, err := manifest.Parse(string(spec), "default")
+	require.NoError(t, err)
+	require.Equal(t, []string{"default, nginx, Deployment (apps)"}, foundObjects(result))
 }
 
 func TestEmpty(t *testing.T) {
 	spec, err := ioutil.ReadFile("testdata/empty.yaml")
 	require.NoError(t, err)
 
-	require.Equal(t,
-		[]string{},
-		foundObjects(manifest.Parse(string(spec), "default")),
-	)
+	result, err := manifest.Parse(string(spec), "default")
+	require.NoError(t, err)
+	require.Equal(t, []string{}, foundObjects(result))
+}
+
+func TestParseReleaseWithHooks(t *testing.T) {
+	spec, err := ioutil.ReadFile("testdata/pod.yaml")
+	require.NoError(t, err)
+	rel := &release.Release{
+		Namespace: "default",
+		Manifest:  string(spec),
+		Hooks: []*release.Hook{
+			{Path: "templates/migrate.yaml", Events: []release.HookEvent{release.HookPostInstall, release.HookPostUpgrade}, Manifest: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+`},
+			{Path: "templates/test.yaml", Events: []release.HookEvent{release.HookTest}, Manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  name: test
+`},
+		},
+	}
+
+	result, err := manifest.ParseReleaseWithHooks(rel)
+	require.NoError(t, err)
+	require.Equal(t, []string{"default, nginx, Pod (v1)"}, foundObjects(result))
+	result, err = manifest.ParseReleaseWithHooks(rel, release.HookPostInstall)
+	require.NoError(t, err)
+	require.Equal(t, []string{"default, migrate, Job (batch)", "default, nginx, Pod (v1)"}, foundObjects(result))
+}
+
+func TestParseError(t *testing.T) {
+	spec := `---
+# Source: chart/templates/pod.yaml
+apiVersion: v1
+kind: Pod
+metadata:
+  name: nginx
+---
+# Source: chart/templates/broken.yaml
+apiVersion: v1
+kind: [Service
+`
+
+	result, err := manifest.Parse(spec, "default")
+	require.Nil(t, result)
+	var parseErr *manifest.ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.Equal(t, "chart/templates/broken.yaml", parseErr.Source)
+	require.Equal(t, 1, parseErr.Index)
+	require.ErrorContains(t, err, "failed to parse document 1 (chart/templates/broken.yaml): YAML unmarshal error")
+}
+
+func TestParseDuplicates(t *testing.T) {
+	spec := `---
+# Source: chart/templates/pod.yaml
+apiVersion: v1
+kind: Pod
+metadata:
+  name: nginx
+---
+# Source: chart/templates/copy.yaml
+apiVersion: v1
+kind: Pod
+metadata:
+  name: nginx
+`
+
+	result, err := manifest.Parse(spec, "default")
+	require.Equal(t, []string{"default, nginx, Pod (v1)"}, foundObjects(result))
+	require.Contains(t, result["default, nginx, Pod (v1)"].Content, "chart/templates/pod.yaml")
+	var duplicateErr *manifest.DuplicateError
+	require.ErrorAs(t, err, &duplicateErr)
+	require.Equal(t, []manifest.Duplicate{{Name: "default, nginx, Pod (v1)", Source: "chart/templates/copy.yaml", Index: 1}}, duplicateErr.Duplicates)
 }